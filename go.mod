@@ -2,4 +2,9 @@ module github.com/tamerfrombk/muka
 
 go 1.16
 
-require github.com/fatih/color v1.10.0
+require (
+	github.com/bmatcuk/doublestar/v4 v4.0.2
+	github.com/cespare/xxhash/v2 v2.1.2
+	github.com/fatih/color v1.10.0
+	golang.org/x/crypto v0.0.0-20210322153248-0c34fe9e7dc2
+)
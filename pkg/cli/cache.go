@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/tamerfrombk/muka/pkg/muka"
+)
+
+const cacheUsage = "usage: muka cache [-file PATH] stats|prune|clear"
+
+// runCache implements the 'muka cache' command which inspects and maintains the hash cache
+func runCache(cacheArgs []string) int {
+	cacheFlags := flag.NewFlagSet("muka cache", flag.ExitOnError)
+	cacheFlags.Usage = func() {
+		fmt.Fprintln(cacheFlags.Output(), cacheUsage)
+		cacheFlags.PrintDefaults()
+	}
+
+	defaultPath, err := muka.DefaultHashCachePath()
+	if err != nil {
+		log.Printf("unable to locate the hash cache: %v", err)
+		return 1
+	}
+
+	pathPtr := cacheFlags.String("file", defaultPath, "the hash cache file")
+
+	cacheFlags.Parse(cacheArgs)
+
+	if cacheFlags.NArg() != 1 {
+		cacheFlags.Usage()
+		return 1
+	}
+
+	cache, err := muka.LoadHashCache(*pathPtr)
+	if err != nil {
+		log.Printf("unable to load the hash cache: %v", err)
+		return 1
+	}
+
+	switch command := cacheFlags.Arg(0); command {
+	case "stats":
+		fmt.Print(cache.Stats())
+		return 0
+	case "prune":
+		pruned := cache.Prune()
+		if err := cache.Save(); err != nil {
+			log.Printf("unable to save the hash cache: %v", err)
+			return 1
+		}
+		fmt.Printf("%d entries were pruned\n", pruned)
+		return 0
+	case "clear":
+		cache.Clear()
+		if err := cache.Save(); err != nil {
+			log.Printf("unable to save the hash cache: %v", err)
+			return 1
+		}
+		fmt.Println("the hash cache was cleared")
+		return 0
+	default:
+		log.Printf("%q is not a cache command", command)
+		cacheFlags.Usage()
+		return 1
+	}
+}
@@ -3,8 +3,13 @@ package cli
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
 
 	"github.com/tamerfrombk/muka/pkg/muka"
 )
@@ -15,31 +20,94 @@ type args struct {
 	IsForce            bool
 	IsDryRun           bool
 	IsReport           bool
+	IsVerify           bool
+	IsCacheDisabled    bool
+	Action             muka.Action
+	LinkStyle          muka.LinkStyle
+	QuarantineDir      string
+	JournalPath        string
+	KeepPolicies       []muka.KeepPolicy
+	Format             muka.Format
 	FileCollectOptions muka.FileCollectionOptions
 }
 
-func parseArgs(mainArgs []string) (args, error) {
-	mukaFlags := flag.NewFlagSet("muka", flag.ExitOnError)
+// stringsFlag is a flag that may be repeated to collect several values
+type stringsFlag []string
 
-	directoryPtr := mukaFlags.String("d", ".", "the directory to search")
+func (s *stringsFlag) String() string {
+
+	return strings.Join(*s, ", ")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+
+	return nil
+}
+
+// parseArgs registers the flags shared by the commands that scan for duplicates on mukaFlags and parses mainArgs.
+// Commands register any flags of their own on mukaFlags beforehand.
+func parseArgs(mukaFlags *flag.FlagSet, mainArgs []string) (args, error) {
+	var directories, referenceDirs stringsFlag
+	mukaFlags.Var(&directories, "d", "a directory to search (repeatable, defaults to the current directory)")
+	mukaFlags.Var(&referenceDirs, "reference", "a directory whose files are only used as originals and never removed (repeatable)")
 	interactivePtr := mukaFlags.Bool("i", false, "enable interactive mode to remove duplicates")
 	forcePtr := mukaFlags.Bool("f", false, "remove duplicates without prompting")
 	dryRunPtr := mukaFlags.Bool("dryrun", false, "do not actually remove any files")
+	actionPtr := mukaFlags.String("action", string(muka.ActionDelete),
+		fmt.Sprintf("what to do with duplicates when removing them (one of %s)", joinValues(muka.Actions)))
+	linkStylePtr := mukaFlags.String("link-style", string(muka.LinkStyleAbsolute),
+		"how symbolic links created by '-action symlink' refer to the original (absolute or relative)")
+	quarantinePtr := mukaFlags.String("quarantine", "", "move duplicates into this directory instead of removing them (implies '-action quarantine')")
+	journalPtr := mukaFlags.String("journal", "", "record removed files in this journal so 'muka undo' can restore them (defaults to $XDG_STATE_HOME/muka/journal.jsonl)")
+	keepPtr := mukaFlags.String("keep", "",
+		fmt.Sprintf("comma separated policies choosing the original to keep, later ones breaking ties (%s)", joinValues(muka.KeepPolicies)))
+	var preferredDirs, protectedDirs stringsFlag
+	mukaFlags.Var(&preferredDirs, "prefer", "choose originals from this directory whenever possible (repeatable)")
+	mukaFlags.Var(&protectedDirs, "protect", "never remove or modify anything under this directory (repeatable)")
+	verifyPtr := mukaFlags.Bool("verify", false, "compare duplicates byte by byte before acting on them")
+	noCachePtr := mukaFlags.Bool("no-cache", false, "do not read or update the persistent hash cache")
+	formatPtr := mukaFlags.String("format", string(muka.FormatText),
+		fmt.Sprintf("how duplicates and the report are written (one of %s)", joinValues(muka.Formats)))
 	reportPtr := mukaFlags.Bool("report", false, "generates a report displaying basic program performance")
+	maxDepthPtr := mukaFlags.Int("max-depth", 0, "descend at most this many levels below each directory searched (0 for no limit)")
+	minDepthPtr := mukaFlags.Int("min-depth", 0, "ignore files less than this many levels below each directory searched")
+	followSymlinksPtr := mukaFlags.Bool("follow-symlinks", false, "descend into linked directories and collect linked files")
+	oneFileSystemPtr := mukaFlags.Bool("one-file-system", false, "do not descend into directories on other filesystems than the directory searched")
+	excludeFsTypePtr := mukaFlags.String("exclude-fstype", "", "comma separated filesystem types to skip, like nfs,tmpfs,proc (linux only)")
+	noIgnorePtr := mukaFlags.Bool("no-ignore", false, "do not skip .git directories and the files matched by .gitignore, .ignore and .mukaignore files")
+	minSizePtr := mukaFlags.String("min-size", "", "ignore files smaller than this size (units like 10K, 10M or 2G are supported)")
+	maxSizePtr := mukaFlags.String("max-size", "", "ignore files larger than this size (units like 10K, 10M or 2G are supported)")
+	newerThanPtr := mukaFlags.String("newer-than", "", "ignore files modified before this date or duration ago (like 2006-01-02, 36h or 7d)")
+	olderThanPtr := mukaFlags.String("older-than", "", "ignore files modified after this date or duration ago (like 2006-01-02, 36h or 7d)")
+	typePtr := mukaFlags.String("type", string(muka.FileTypeRegular),
+		fmt.Sprintf("the kinds of files to consider (one of %s)", joinValues(muka.FileTypes)))
+	var includePatterns, excludePatterns stringsFlag
+	mukaFlags.Var(&includePatterns, "include", "only consider files whose path relative to the directory searched matches this glob, like '**/*.jpg' (repeatable)")
+	mukaFlags.Var(&excludePatterns, "exclude", "skip files and directories whose path relative to the directory searched matches this glob, like 'vendor/**/testdata' (repeatable)")
 	excludeDirsPtr := mukaFlags.String("X", "", "exclude the provided directories from consideration (regex supported)")
 	excludeFilesPtr := mukaFlags.String("x", "", "exclude the provided files from consideration (regex supported)")
+	hashPtr := mukaFlags.String("hash", muka.DefaultHasherName,
+		fmt.Sprintf("the hash algorithm used to compare files (one of %s)", strings.Join(muka.HasherNames(), ", ")))
+	parallelismPtr := mukaFlags.Int("j", muka.DefaultParallelism(), "the number of files to hash concurrently")
 
 	mukaFlags.Parse(mainArgs)
 
+	originalDirectory := strings.Join(directories, ", ")
+	if len(directories) == 0 {
+		originalDirectory = "."
+		directories = stringsFlag{"."}
+	}
+
 	var directoryToSearch string
 	var err error
-	if *directoryPtr == "." {
+	if directories[0] == "." {
 		directoryToSearch, err = os.Getwd()
 		if err != nil {
 			return args{}, err
 		}
 	} else {
-		directoryToSearch = *directoryPtr
+		directoryToSearch = directories[0]
 	}
 
 	excludeDirs, err := muka.CompileSpaceSeparatedPatterns(*excludeDirsPtr)
@@ -52,29 +120,125 @@ func parseArgs(mainArgs []string) (args, error) {
 		return args{}, nil
 	}
 
+	action := muka.Action(*actionPtr)
+	if *quarantinePtr != "" {
+		action = muka.ActionQuarantine
+	}
+
+	keepPolicies, err := muka.ParseKeepPolicies(*keepPtr)
+	if err != nil {
+		return args{}, err
+	}
+
+	hasher, err := muka.LookupHasher(*hashPtr)
+	if err != nil {
+		return args{}, err
+	}
+
+	fileType, err := muka.ParseFileType(*typePtr)
+	if err != nil {
+		return args{}, err
+	}
+
+	var minSize, maxSize int64
+	if *minSizePtr != "" {
+		if minSize, err = muka.ParseSize(*minSizePtr); err != nil {
+			return args{}, err
+		}
+	}
+	if *maxSizePtr != "" {
+		if maxSize, err = muka.ParseSize(*maxSizePtr); err != nil {
+			return args{}, err
+		}
+	}
+
+	var newerThan, olderThan time.Time
+	now := time.Now()
+	if *newerThanPtr != "" {
+		if newerThan, err = muka.ParseTime(*newerThanPtr, now); err != nil {
+			return args{}, err
+		}
+	}
+	if *olderThanPtr != "" {
+		if olderThan, err = muka.ParseTime(*olderThanPtr, now); err != nil {
+			return args{}, err
+		}
+	}
+
 	return args{
-		OriginalDirectory: *directoryPtr,
+		OriginalDirectory: originalDirectory,
 		IsInteractive:     *interactivePtr,
 		IsForce:           *forcePtr,
 		IsDryRun:          *dryRunPtr,
 		IsReport:          *reportPtr,
+		IsVerify:          *verifyPtr,
+		IsCacheDisabled:   *noCachePtr,
+		Action:            action,
+		QuarantineDir:     *quarantinePtr,
+		JournalPath:       *journalPtr,
+		KeepPolicies:      keepPolicies,
+		Format:            muka.Format(*formatPtr),
+		LinkStyle:         muka.LinkStyle(*linkStylePtr),
 		FileCollectOptions: muka.FileCollectionOptions{
-			DirectoryToSearch: directoryToSearch,
-			ExcludeDirs:       excludeDirs,
-			ExcludeFiles:      excludeFiles,
+			DirectoryToSearch:      directoryToSearch,
+			DirectoriesToSearch:    directories[1:],
+			ReferenceDirectories:   referenceDirs,
+			ExcludeDirs:            excludeDirs,
+			ExcludeFiles:           excludeFiles,
+			IncludePatterns:        includePatterns,
+			ExcludePatterns:        excludePatterns,
+			Parallelism:            *parallelismPtr,
+			Hasher:                 hasher,
+			PreferredDirectories:   preferredDirs,
+			ProtectedDirectories:   protectedDirs,
+			MaxDepth:               *maxDepthPtr,
+			MinDepth:               *minDepthPtr,
+			FollowSymlinks:         *followSymlinksPtr,
+			OneFileSystem:          *oneFileSystemPtr,
+			ExcludeFilesystemTypes: splitCommaSeparated(*excludeFsTypePtr),
+			NoIgnore:               *noIgnorePtr,
+			MinSize:                minSize,
+			MaxSize:                maxSize,
+			NewerThan:              newerThan,
+			OlderThan:              olderThan,
+			Type:                   fileType,
 		},
 	}, nil
 }
 
+// splitCommaSeparated returns the non empty values of a comma separated list
+func splitCommaSeparated(s string) []string {
+	var values []string
+	for _, value := range strings.Split(s, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// joinValues joins the names of a list of string based values, like muka.Actions, for flag usages
+func joinValues(values interface{}) string {
+	list := reflect.ValueOf(values)
+
+	names := make([]string, 0, list.Len())
+	for i := 0; i < list.Len(); i++ {
+		names = append(names, list.Index(i).String())
+	}
+
+	return strings.Join(names, ", ")
+}
+
 func setupLogger() {
 	// Prevent displaying any additional data to log messages
 	log.SetFlags(0)
 }
 
-func onInteractive(deleter muka.Deleter, duplicates []muka.DuplicateFile) []muka.FileHash {
+func onInteractive(prompts io.Writer, deleter muka.Deleter, duplicates []muka.DuplicateFile) []muka.FileHash {
 	var deletedFiles []muka.FileHash
 	for _, duplicate := range duplicates {
-		files, err := muka.PromptToDelete(os.Stdout, os.Stdin, deleter, duplicate)
+		files, err := muka.PromptToDelete(prompts, os.Stdin, deleter, duplicate)
 		if err == nil {
 			for _, f := range files {
 				deletedFiles = append(deletedFiles, f)
@@ -85,38 +249,185 @@ func onInteractive(deleter muka.Deleter, duplicates []muka.DuplicateFile) []muka
 	return deletedFiles
 }
 
+// loadHashCache loads the persistent hash cache from its default location
+func loadHashCache() (*muka.HashCache, error) {
+	path, err := muka.DefaultHashCachePath()
+	if err != nil {
+		return nil, err
+	}
+
+	return muka.LoadHashCache(path)
+}
+
+// deleterOptions builds the options of the Deleter selected by args
+func deleterOptions(args args) (muka.DeleterOptions, error) {
+	journalPath := args.JournalPath
+	if journalPath == "" {
+		var err error
+		if journalPath, err = muka.DefaultJournalPath(); err != nil {
+			return muka.DeleterOptions{}, err
+		}
+	}
+
+	// plans may be applied from another working directory so only absolute paths are recorded
+	options := args.FileCollectOptions
+	roots := append([]string{options.DirectoryToSearch}, options.DirectoriesToSearch...)
+	roots, err := muka.AbsolutePaths(append(roots, options.ReferenceDirectories...))
+	if err != nil {
+		return muka.DeleterOptions{}, err
+	}
+
+	quarantineDir := args.QuarantineDir
+	if quarantineDir != "" {
+		if quarantineDir, err = filepath.Abs(quarantineDir); err != nil {
+			return muka.DeleterOptions{}, err
+		}
+	}
+
+	// reference files must never be acted upon either
+	protected := append([]string{}, options.ProtectedDirectories...)
+	protected, err = muka.AbsolutePaths(append(protected, options.ReferenceDirectories...))
+	if err != nil {
+		return muka.DeleterOptions{}, err
+	}
+
+	return muka.DeleterOptions{
+		Action:        args.Action,
+		IsDryRun:      args.IsDryRun,
+		LinkStyle:     args.LinkStyle,
+		QuarantineDir: quarantineDir,
+		Roots:         roots,
+		Journal:       muka.NewJournal(journalPath),
+		Protected:     protected,
+	}, nil
+}
+
+// findDuplicates scans the directory selected by args and returns what was found along with the duplicates
+func findDuplicates(args args) (muka.Directory, []muka.DuplicateFile, error) {
+	if !args.IsCacheDisabled {
+		cache, err := loadHashCache()
+		if err != nil {
+			// the cache is only an optimization so carry on without it
+			log.Printf("unable to load the hash cache: %v", err)
+		} else {
+			args.FileCollectOptions.HashCache = cache
+		}
+	}
+
+	directory, err := muka.CollectFiles(args.FileCollectOptions)
+	if err != nil {
+		return muka.Directory{}, nil, err
+	}
+
+	for _, skipped := range directory.SkippedSymlinks {
+		log.Printf("skipped %q: %s", skipped.Path, skipped.Reason)
+	}
+
+	if cache := args.FileCollectOptions.HashCache; cache != nil {
+		if err := cache.Save(); err != nil {
+			log.Printf("unable to save the hash cache: %v", err)
+		}
+	}
+
+	duplicates := muka.FindDuplicateFiles(directory, args.KeepPolicies...)
+	if args.IsVerify {
+		duplicates = muka.VerifyDuplicates(duplicates, args.KeepPolicies...)
+	}
+
+	return directory, duplicates, nil
+}
+
 // Run main entry point
 func Run(mainArgs []string) int {
 
 	setupLogger()
 
-	args, err := parseArgs(mainArgs)
+	if len(mainArgs) > 0 {
+		switch mainArgs[0] {
+		case "cache":
+			return runCache(mainArgs[1:])
+		case "undo":
+			return runUndo(mainArgs[1:])
+		case "plan":
+			return runPlan(mainArgs[1:])
+		case "apply":
+			return runApply(mainArgs[1:])
+		case "import":
+			return runImport(mainArgs[1:])
+		}
+	}
+
+	args, err := parseArgs(flag.NewFlagSet("muka", flag.ExitOnError), mainArgs)
 	if err != nil {
 		log.Printf("unable to parse arguments: %v", err)
 		return 1
 	}
 
-	directory, err := muka.CollectFiles(args.FileCollectOptions)
+	options, err := deleterOptions(args)
+	if err != nil {
+		log.Printf("unable to set up the %q action: %v", args.Action, err)
+		return 1
+	}
+
+	deleter, err := muka.NewDeleter(options)
+	if err != nil {
+		log.Printf("unable to set up the %q action: %v", args.Action, err)
+		return 1
+	}
+
+	writer, err := muka.NewDuplicateWriter(os.Stdout, os.Stderr, args.Format)
+	if err != nil {
+		log.Printf("unable to write duplicates: %v", err)
+		return 1
+	}
+
+	directory, duplicates, err := findDuplicates(args)
 	if err != nil {
 		log.Printf("unable to find files in %q: %v", args.OriginalDirectory, err)
 		return 1
 	}
 
-	deleter := muka.MakeDeleter(args.IsDryRun)
-	duplicates := muka.FindDuplicateFiles(directory)
+	return handleDuplicates(args, deleter, writer, directory, duplicates)
+}
+
+// handleDuplicates writes the duplicates out and removes them as args asks, followed by the report when requested.
+// Every group is written whatever the mode so that the output always matches the report.
+func handleDuplicates(args args, deleter muka.Deleter, writer muka.DuplicateWriter, directory muka.Directory, duplicates []muka.DuplicateFile) int {
+	isText := args.Format == muka.FormatText || args.Format == ""
+
+	// the prompts of interactive mode already show every group as text
+	if args.IsForce || !args.IsInteractive || !isText {
+		for _, duplicate := range duplicates {
+			if err := writer.WriteGroup(duplicate); err != nil {
+				log.Printf("unable to write duplicates: %v", err)
+				return 1
+			}
+		}
+	}
 
 	var deletedFiles []muka.FileHash
 	if args.IsForce {
 		deletedFiles = muka.ForceDelete(duplicates, deleter)
 	} else if args.IsInteractive {
-		deletedFiles = onInteractive(deleter, duplicates)
-	} else {
-		muka.PrintDuplicates(duplicates)
+		// prompts must not end up in the middle of a document meant for another program
+		prompts := os.Stdout
+		if !isText {
+			prompts = os.Stderr
+		}
+		deletedFiles = onInteractive(prompts, deleter, duplicates)
 	}
 
 	if args.IsReport {
 		report := muka.CalculateReport(directory, duplicates, deletedFiles)
-		fmt.Println(report)
+		if err := writer.WriteReport(report); err != nil {
+			log.Printf("unable to write the report: %v", err)
+			return 1
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		log.Printf("unable to write duplicates: %v", err)
+		return 1
 	}
 
 	return 0
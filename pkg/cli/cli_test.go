@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func getTestingDir(dir string) string {
+	return filepath.Join("..", "..", "test", "testdata", dir)
+}
+
+// runCapturingStdout runs muka with args and returns its exit code along with everything it wrote to stdout
+func runCapturingStdout(t *testing.T, args ...string) (int, []byte) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	output := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		output <- b
+	}()
+
+	stdout := os.Stdout
+	os.Stdout = w
+	code := Run(args)
+	os.Stdout = stdout
+	w.Close()
+
+	return code, <-output
+}
+
+func TestForceDryRunWritesEveryGroupAsJSON(t *testing.T) {
+	code, output := runCapturingStdout(t, "-d", getTestingDir("small"), "-f", "-dryrun", "-no-cache", "--format", "json", "-report")
+	if code != 0 {
+		t.Fatalf("expected muka to succeed but it exited with %d", code)
+	}
+
+	var document struct {
+		Groups []struct {
+			Original   string   `json:"original"`
+			Duplicates []string `json:"duplicates"`
+		} `json:"groups"`
+		Report struct {
+			DuplicateFileCount int `json:"duplicate_file_count"`
+		} `json:"report"`
+	}
+	if err := json.Unmarshal(output, &document); err != nil {
+		t.Fatalf("expected a single JSON document but got %q: %v", output, err)
+	}
+
+	if len(document.Groups) != 1 {
+		t.Fatalf("expected 1 group but got %d", len(document.Groups))
+	}
+
+	if len(document.Groups[0].Duplicates) != 2 {
+		t.Errorf("expected 2 duplicates but got %d", len(document.Groups[0].Duplicates))
+	}
+
+	if document.Report.DuplicateFileCount != 2 {
+		t.Errorf("expected the report to count 2 duplicates but got %d", document.Report.DuplicateFileCount)
+	}
+}
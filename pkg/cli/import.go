@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/tamerfrombk/muka/pkg/muka"
+)
+
+const importUsage = "usage: muka import [-from fdupes|jdupes|rmlint] [flags] FILE ('-' for stdin)"
+
+// runImport implements the 'muka import' command which acts on the duplicates found by another duplicate finder
+func runImport(importArgs []string) int {
+	importFlags := flag.NewFlagSet("muka import", flag.ExitOnError)
+	importFlags.Usage = func() {
+		fmt.Fprintln(importFlags.Output(), importUsage)
+		importFlags.PrintDefaults()
+	}
+
+	fromPtr := importFlags.String("from", string(muka.ImportFdupes),
+		fmt.Sprintf("the program that wrote FILE (one of %s)", joinValues(muka.ImportFormats)))
+
+	args, err := parseArgs(importFlags, importArgs)
+	if err != nil {
+		log.Printf("unable to parse arguments: %v", err)
+		return 1
+	}
+
+	if importFlags.NArg() != 1 {
+		importFlags.Usage()
+		return 1
+	}
+
+	options, err := deleterOptions(args)
+	if err != nil {
+		log.Printf("unable to set up the %q action: %v", args.Action, err)
+		return 1
+	}
+
+	deleter, err := muka.NewDeleter(options)
+	if err != nil {
+		log.Printf("unable to set up the %q action: %v", args.Action, err)
+		return 1
+	}
+
+	writer, err := muka.NewDuplicateWriter(os.Stdout, os.Stderr, args.Format)
+	if err != nil {
+		log.Printf("unable to write duplicates: %v", err)
+		return 1
+	}
+
+	input := os.Stdin
+	if path := importFlags.Arg(0); path != "-" {
+		if input, err = os.Open(path); err != nil {
+			log.Printf("unable to open %q: %v", path, err)
+			return 1
+		}
+		defer input.Close()
+	}
+
+	groups, err := muka.ParseDuplicateGroups(input, muka.ImportFormat(*fromPtr))
+	if err != nil {
+		log.Printf("unable to read %q: %v", importFlags.Arg(0), err)
+		return 1
+	}
+
+	directory, err := muka.ImportFiles(groups, args.FileCollectOptions)
+	if err != nil {
+		log.Printf("unable to import %q: %v", importFlags.Arg(0), err)
+		return 1
+	}
+
+	duplicates := muka.FindDuplicateFiles(directory, args.KeepPolicies...)
+	if args.IsVerify {
+		duplicates = muka.VerifyDuplicates(duplicates, args.KeepPolicies...)
+	}
+
+	return handleDuplicates(args, deleter, writer, directory, duplicates)
+}
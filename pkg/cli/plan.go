@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/tamerfrombk/muka/pkg/muka"
+)
+
+const applyUsage = "usage: muka apply [-dryrun] [-journal PATH] [-protect DIR] plan.json"
+
+// runPlan implements the 'muka plan' command which writes the duplicates and what to do with them to a plan file
+func runPlan(planArgs []string) int {
+	planFlags := flag.NewFlagSet("muka plan", flag.ExitOnError)
+	outputPtr := planFlags.String("o", "-", "the file the plan is written to ('-' for stdout)")
+
+	args, err := parseArgs(planFlags, planArgs)
+	if err != nil {
+		log.Printf("unable to parse arguments: %v", err)
+		return 1
+	}
+
+	options, err := deleterOptions(args)
+	if err != nil {
+		log.Printf("unable to set up the %q action: %v", args.Action, err)
+		return 1
+	}
+
+	// the plan must be applicable as written so the action is validated now
+	if _, err := muka.NewDeleter(options); err != nil {
+		log.Printf("unable to set up the %q action: %v", args.Action, err)
+		return 1
+	}
+
+	_, duplicates, err := findDuplicates(args)
+	if err != nil {
+		log.Printf("unable to find files in %q: %v", args.OriginalDirectory, err)
+		return 1
+	}
+
+	output := os.Stdout
+	if *outputPtr != "-" {
+		if output, err = os.Create(*outputPtr); err != nil {
+			log.Printf("unable to create the plan: %v", err)
+			return 1
+		}
+	}
+
+	err = muka.WritePlan(output, muka.NewPlan(duplicates, options))
+	if output != os.Stdout {
+		if closeErr := output.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	if err != nil {
+		log.Printf("unable to write the plan: %v", err)
+		return 1
+	}
+
+	return 0
+}
+
+// runApply implements the 'muka apply' command which carries out a plan written by 'muka plan'
+func runApply(applyArgs []string) int {
+	applyFlags := flag.NewFlagSet("muka apply", flag.ExitOnError)
+	applyFlags.Usage = func() {
+		fmt.Fprintln(applyFlags.Output(), applyUsage)
+		applyFlags.PrintDefaults()
+	}
+
+	dryRunPtr := applyFlags.Bool("dryrun", false, "do not actually remove any files")
+	journalPtr := applyFlags.String("journal", "", "record removed files in this journal so 'muka undo' can restore them (defaults to $XDG_STATE_HOME/muka/journal.jsonl)")
+
+	var protectedDirs stringsFlag
+	applyFlags.Var(&protectedDirs, "protect", "never remove or modify anything under this directory, in addition to those protected by the plan (repeatable)")
+
+	applyFlags.Parse(applyArgs)
+
+	if applyFlags.NArg() != 1 {
+		applyFlags.Usage()
+		return 1
+	}
+
+	f, err := os.Open(applyFlags.Arg(0))
+	if err != nil {
+		log.Printf("unable to open the plan: %v", err)
+		return 1
+	}
+	defer f.Close()
+
+	plan, err := muka.ReadPlan(f)
+	if err != nil {
+		log.Printf("unable to read the plan %q: %v", applyFlags.Arg(0), err)
+		return 1
+	}
+
+	plan.Protected = append(plan.Protected, protectedDirs...)
+
+	journalPath := *journalPtr
+	if journalPath == "" {
+		if journalPath, err = muka.DefaultJournalPath(); err != nil {
+			log.Printf("unable to locate the journal: %v", err)
+			return 1
+		}
+	}
+
+	appliedFiles, err := muka.ApplyPlan(plan, *dryRunPtr, muka.NewJournal(journalPath))
+	if err != nil {
+		log.Printf("unable to apply the plan: %v", err)
+		return 1
+	}
+
+	fmt.Printf("%d files were acted upon\n", len(appliedFiles))
+
+	return 0
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/tamerfrombk/muka/pkg/muka"
+)
+
+const undoUsage = `usage: muka undo [-runs N] [journal]
+
+Reverses the operations of the most recent run of muka recorded in the journal. Runs that only
+deleted files, which cannot be restored, are passed over and their deletions are listed.`
+
+// runUndo implements the 'muka undo' command which reverses the operations recorded in a journal
+func runUndo(undoArgs []string) int {
+	undoFlags := flag.NewFlagSet("muka undo", flag.ExitOnError)
+	undoFlags.Usage = func() {
+		fmt.Fprintln(undoFlags.Output(), undoUsage)
+		undoFlags.PrintDefaults()
+	}
+
+	runsPtr := undoFlags.Int("runs", 1, "undo this many of the most recent runs (0 for every run in the journal)")
+
+	undoFlags.Parse(undoArgs)
+
+	var path string
+	switch undoFlags.NArg() {
+	case 0:
+		var err error
+		if path, err = muka.DefaultJournalPath(); err != nil {
+			log.Printf("unable to locate the journal: %v", err)
+			return 1
+		}
+	case 1:
+		path = undoFlags.Arg(0)
+	default:
+		undoFlags.Usage()
+		return 1
+	}
+
+	result, err := muka.NewJournal(path).Undo(*runsPtr)
+	for _, entry := range result.Undone {
+		fmt.Printf("'%s' was restored.\n", entry.Path)
+	}
+
+	for _, entry := range result.Irreversible {
+		fmt.Printf("'%s' was deleted on %s and cannot be restored.\n", entry.Path, entry.Time.Format("2006-01-02 15:04:05"))
+	}
+
+	if err != nil {
+		log.Printf("unable to update the journal %q: %v", path, err)
+		return 1
+	}
+
+	if len(result.Undone) == 0 && len(result.Irreversible) == 0 && len(result.Failed) == 0 {
+		fmt.Println("there is nothing to undo")
+	}
+
+	if len(result.Failed) > 0 {
+		return 1
+	}
+
+	return 0
+}
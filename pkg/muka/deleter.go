@@ -2,35 +2,177 @@ package muka
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"path/filepath"
 )
 
-// Deleter delete function interface
+// Deleter disposes of a duplicate file in favor of the original it duplicates
 type Deleter interface {
-	Delete(path string) error
+	Delete(duplicate, original FileHash) error
 }
 
-type nopDeleter struct{}
+// Action names a way of disposing of duplicate files
+type Action string
 
-func (nop nopDeleter) Delete(path string) error {
+const (
+	// ActionDelete removes duplicates
+	ActionDelete Action = "delete"
+	// ActionHardLink replaces duplicates with hard links to their original
+	ActionHardLink Action = "hardlink"
+	// ActionSymlink replaces duplicates with symbolic links to their original
+	ActionSymlink Action = "symlink"
+	// ActionTrash moves duplicates to the trash
+	ActionTrash Action = "trash"
+	// ActionQuarantine moves duplicates into a quarantine directory
+	ActionQuarantine Action = "quarantine"
+)
+
+// Actions lists every supported Action
+var Actions = []Action{ActionDelete, ActionHardLink, ActionSymlink, ActionTrash, ActionQuarantine}
+
+// LinkStyle controls how the target of a symbolic link is written
+type LinkStyle string
+
+const (
+	// LinkStyleAbsolute links to the absolute path of the original
+	LinkStyleAbsolute LinkStyle = "absolute"
+	// LinkStyleRelative links to the path of the original relative to the link
+	LinkStyleRelative LinkStyle = "relative"
+)
+
+// DeleterOptions options used by NewDeleter
+type DeleterOptions struct {
+	Action   Action
+	IsDryRun bool
+	// LinkStyle is used by ActionSymlink. Defaults to LinkStyleAbsolute when empty.
+	LinkStyle LinkStyle
+	// QuarantineDir is the directory ActionQuarantine moves duplicates into
+	QuarantineDir string
+	// Roots are the directories that were searched. ActionQuarantine mirrors paths relative to the
+	// deepest of them containing each file.
+	Roots []string
+	// Journal, when not nil, records every operation so that it can be undone
+	Journal *Journal
+	// Protected lists directories whose files are never acted upon
+	Protected []string
+}
+
+// nopDeleter logs what would be done to every duplicate so the messages never mix with the duplicates written out
+type nopDeleter struct {
+	options DeleterOptions
+}
 
-	fmt.Printf("'%s' would be removed.\n", path)
+func (nop nopDeleter) Delete(duplicate, original FileHash) error {
+
+	switch nop.options.Action {
+	case ActionHardLink:
+		log.Printf("'%s' would be replaced with a hard link to '%s'.", duplicate.AbsolutePath, original.AbsolutePath)
+	case ActionSymlink:
+		target, err := symlinkTarget(duplicate, original, nop.options.LinkStyle)
+		if err != nil {
+			return err
+		}
+		log.Printf("'%s' would be replaced with a symbolic link to '%s'.", duplicate.AbsolutePath, target)
+	case ActionTrash:
+		log.Printf("'%s' would be moved to the trash.", duplicate.AbsolutePath)
+	case ActionQuarantine:
+		log.Printf("'%s' would be moved to '%s'.", duplicate.AbsolutePath,
+			quarantinePath(nop.options.QuarantineDir, nop.options.Roots, duplicate.AbsolutePath))
+	default:
+		log.Printf("'%s' would be removed.", duplicate.AbsolutePath)
+	}
 
 	return nil
 }
 
-type fileDeleter struct{}
+type fileDeleter struct {
+	journal *Journal
+}
+
+func (impl fileDeleter) Delete(duplicate, original FileHash) error {
+	if err := os.Remove(duplicate.AbsolutePath); err != nil {
+		return err
+	}
 
-func (impl fileDeleter) Delete(path string) error {
+	recordOperation(impl.journal, ActionDelete, duplicate, original, "")
 
-	return os.Remove(path)
+	return nil
 }
 
 // MakeDeleter a Deleter factory function
 func MakeDeleter(isDryRun bool) Deleter {
 	if isDryRun {
-		return nopDeleter{}
+		return nopDeleter{options: DeleterOptions{Action: ActionDelete}}
 	}
 
 	return fileDeleter{}
 }
+
+// NewDeleter a Deleter factory function for any of the supported Actions.
+// The returned Deleter refuses to act on files under options.Protected.
+func NewDeleter(options DeleterOptions) (Deleter, error) {
+
+	deleter, err := newActionDeleter(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(options.Protected) == 0 {
+		return deleter, nil
+	}
+
+	protected, err := resolveDirs(options.Protected)
+	if err != nil {
+		return nil, err
+	}
+
+	return protectingDeleter{deleter: deleter, protected: protected}, nil
+}
+
+func newActionDeleter(options DeleterOptions) (Deleter, error) {
+
+	switch options.LinkStyle {
+	case "":
+		options.LinkStyle = LinkStyleAbsolute
+	case LinkStyleAbsolute, LinkStyleRelative:
+	default:
+		return nil, fmt.Errorf("unknown link style %q", options.LinkStyle)
+	}
+
+	if options.Action == ActionQuarantine {
+		if options.QuarantineDir == "" {
+			return nil, fmt.Errorf("the %q action requires a quarantine directory", options.Action)
+		}
+
+		var err error
+		if options.QuarantineDir, err = filepath.Abs(options.QuarantineDir); err != nil {
+			return nil, err
+		}
+		if options.Roots, err = AbsolutePaths(options.Roots); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.IsDryRun {
+		switch options.Action {
+		case ActionDelete, ActionHardLink, ActionSymlink, ActionTrash, ActionQuarantine:
+			return nopDeleter{options: options}, nil
+		}
+	}
+
+	switch options.Action {
+	case ActionDelete:
+		return fileDeleter{journal: options.Journal}, nil
+	case ActionHardLink:
+		return hardLinker{journal: options.Journal}, nil
+	case ActionSymlink:
+		return symLinker{linkStyle: options.LinkStyle, journal: options.Journal}, nil
+	case ActionTrash:
+		return trasher{journal: options.Journal}, nil
+	case ActionQuarantine:
+		return quarantiner{dir: options.QuarantineDir, roots: options.Roots, journal: options.Journal}, nil
+	default:
+		return nil, fmt.Errorf("unknown action %q", options.Action)
+	}
+}
@@ -15,6 +15,14 @@ func FileExists(fileName string) bool {
 	return !info.IsDir()
 }
 
+func fileHashOf(path string) FileHash {
+	return FileHash{
+		FileData: FileData{
+			AbsolutePath: path,
+		},
+	}
+}
+
 func TestMakeDeleterOnDryRunShouldKeepFile(t *testing.T) {
 	f, err := ioutil.TempFile("", "TestMuka")
 	if err != nil {
@@ -23,7 +31,7 @@ func TestMakeDeleterOnDryRunShouldKeepFile(t *testing.T) {
 	defer os.Remove(f.Name())
 
 	deleter := MakeDeleter(true)
-	if err := deleter.Delete(f.Name()); err != nil {
+	if err := deleter.Delete(fileHashOf(f.Name()), FileHash{}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -40,7 +48,7 @@ func TestMakeDeleterOnWithoutDryRunShouldRemoveFile(t *testing.T) {
 	defer os.Remove(f.Name())
 
 	deleter := MakeDeleter(false)
-	if err := deleter.Delete(f.Name()); err != nil {
+	if err := deleter.Delete(fileHashOf(f.Name()), FileHash{}); err != nil {
 		t.Fatal(err)
 	}
 
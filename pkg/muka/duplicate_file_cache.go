@@ -1,24 +1,38 @@
 package muka
 
-// DuplicateFileCache holds a cache of possible duplicate muka
+// DuplicateFileCache holds a cache of possible duplicate muka.
+// Files are only ever grouped with files hashed by the same algorithm.
 type DuplicateFileCache struct {
-	fileHashByHash map[string]FileHash
+	fileHashByHash map[hashKey]FileHash
 	duplicates     []DuplicateFile
+	policies       []KeepPolicy
 }
 
-// NewCache duplicateFileCache constructor
-func NewCache() DuplicateFileCache {
+type hashKey struct {
+	algorithm string
+	hash      string
+}
+
+func keyOf(hash FileHash) hashKey {
+
+	return hashKey{algorithm: hash.Algorithm, hash: hash.Hash}
+}
+
+// NewCache duplicateFileCache constructor. The policies choose the original of each group of duplicates,
+// later policies breaking the ties of earlier ones. Without policies, the first file added is the original.
+func NewCache(policies ...KeepPolicy) DuplicateFileCache {
 
 	return DuplicateFileCache{
-		fileHashByHash: make(map[string]FileHash),
+		fileHashByHash: make(map[hashKey]FileHash),
 		duplicates:     make([]DuplicateFile, 0),
+		policies:       policies,
 	}
 }
 
 func (cache *DuplicateFileCache) findDuplicateFile(hash FileHash) int {
 
 	for i, dup := range cache.duplicates {
-		if dup.Original.Hash == hash.Hash {
+		if keyOf(dup.Original) == keyOf(hash) {
 			return i
 		}
 	}
@@ -28,13 +42,13 @@ func (cache *DuplicateFileCache) findDuplicateFile(hash FileHash) int {
 
 // Add adds a FileHash to the cache accounting for possible duplicates
 func (cache *DuplicateFileCache) Add(hash FileHash) {
-	if _, exists := cache.fileHashByHash[hash.Hash]; exists {
+	if _, exists := cache.fileHashByHash[keyOf(hash)]; exists {
 		idx := cache.findDuplicateFile(hash)
 		// no need to check idx since we know we have it
 		dup := &cache.duplicates[idx]
 		dup.Duplicates = append(dup.Duplicates, hash)
 	} else {
-		cache.fileHashByHash[hash.Hash] = hash
+		cache.fileHashByHash[keyOf(hash)] = hash
 		cache.duplicates = append(cache.duplicates, DuplicateFile{
 			Original:   hash,
 			Duplicates: make([]FileHash, 0),
@@ -49,8 +63,22 @@ func (cache *DuplicateFileCache) GetDuplicates() []DuplicateFile {
 
 	nonEmptyDuplicates := make([]DuplicateFile, 0, len(allDuplicates))
 	for _, d := range allDuplicates {
-		if len(d.Duplicates) > 0 && d.Original.Hash != "" {
-			nonEmptyDuplicates = append(nonEmptyDuplicates, d)
+		if len(d.Duplicates) == 0 || d.Original.Hash == "" {
+			continue
+		}
+
+		// reference files are never candidates for deletion
+		selected := selectOriginal(d, cache.policies)
+		candidates := make([]FileHash, 0, len(selected.Duplicates))
+		for _, f := range selected.Duplicates {
+			if !f.IsReference {
+				candidates = append(candidates, f)
+			}
+		}
+		selected.Duplicates = candidates
+
+		if len(selected.Duplicates) > 0 {
+			nonEmptyDuplicates = append(nonEmptyDuplicates, selected)
 		}
 	}
 
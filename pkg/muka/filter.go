@@ -0,0 +1,144 @@
+package muka
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileType selects the kinds of files CollectFiles collects
+type FileType string
+
+const (
+	// FileTypeAny collects every file that is not a directory, devices, named pipes and sockets included.
+	// Those are read like any other file so hashing a named pipe waits until something writes to it.
+	FileTypeAny FileType = "any"
+	// FileTypeRegular collects regular files, including empty ones. It is the default.
+	FileTypeRegular FileType = "regular"
+	// FileTypeNonEmpty collects regular files that are not empty
+	FileTypeNonEmpty FileType = "nonempty"
+)
+
+// FileTypes lists every supported FileType
+var FileTypes = []FileType{FileTypeAny, FileTypeRegular, FileTypeNonEmpty}
+
+// ParseFileType returns the FileType named s. An empty string is FileTypeRegular.
+func ParseFileType(s string) (FileType, error) {
+	if s == "" {
+		return FileTypeRegular, nil
+	}
+
+	for _, fileType := range FileTypes {
+		if FileType(s) == fileType {
+			return fileType, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown file type %q", s)
+}
+
+// sizeUnits are the multipliers of the size suffixes accepted by ParseSize
+var sizeUnits = map[string]int64{
+	"":  1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+// ParseSize parses a size in bytes with an optional K, M, G or T suffix, like 10M or 2G.
+// Units are powers of 1024 and may be followed by B or iB, so 10M, 10MB and 10MiB are all the same size.
+func ParseSize(s string) (int64, error) {
+	number := strings.TrimSpace(s)
+	upper := strings.ToUpper(number)
+	for _, suffix := range []string{"IB", "B"} {
+		if strings.HasSuffix(upper, suffix) {
+			upper = strings.TrimSuffix(upper, suffix)
+			break
+		}
+	}
+
+	unit := ""
+	if len(upper) > 0 {
+		if _, isUnit := sizeUnits[upper[len(upper)-1:]]; isUnit {
+			unit = upper[len(upper)-1:]
+			upper = upper[:len(upper)-1]
+		}
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(upper), 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	return int64(value * float64(sizeUnits[unit])), nil
+}
+
+// ParseTime parses either a point in time or how long before now it was. Points in time are dates
+// like 2006-01-02 or RFC 3339 timestamps. Durations are anything time.ParseDuration accepts along
+// with days and weeks, like 36h, 7d or 2w.
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	duration, err := parseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date or duration %q", s)
+	}
+
+	return now.Add(-duration), nil
+}
+
+// parseDuration is time.ParseDuration with support for a single day or week unit
+func parseDuration(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(s, suffix) {
+			value, err := strconv.ParseFloat(strings.TrimSuffix(s, suffix), 64)
+			if err != nil {
+				return 0, err
+			}
+			return time.Duration(value * float64(unit)), nil
+		}
+	}
+
+	return time.ParseDuration(s)
+}
+
+// filtered reports whether the size, age or type of the file described by info rules it out
+func (options FileCollectionOptions) filtered(info os.FileInfo) bool {
+	switch options.Type {
+	case FileTypeAny:
+		// devices, named pipes and sockets are only collected when asked for since reading one may never end
+	case FileTypeNonEmpty:
+		if !info.Mode().IsRegular() || info.Size() == 0 {
+			return true
+		}
+	default:
+		if !info.Mode().IsRegular() {
+			return true
+		}
+	}
+
+	if info.Size() < options.MinSize {
+		return true
+	}
+
+	if options.MaxSize > 0 && info.Size() > options.MaxSize {
+		return true
+	}
+
+	if !options.NewerThan.IsZero() && !info.ModTime().After(options.NewerThan) {
+		return true
+	}
+
+	if !options.OlderThan.IsZero() && !info.ModTime().Before(options.OlderThan) {
+		return true
+	}
+
+	return false
+}
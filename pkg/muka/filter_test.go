@@ -0,0 +1,179 @@
+package muka
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"0":      0,
+		"512":    512,
+		"512B":   512,
+		"10K":    10 << 10,
+		"10k":    10 << 10,
+		"10M":    10 << 20,
+		"10MB":   10 << 20,
+		"10MiB":  10 << 20,
+		"2G":     2 << 30,
+		"1.5G":   3 << 29,
+		"1T":     1 << 40,
+		" 4 KB ": 4 << 10,
+	}
+
+	for s, expected := range tests {
+		size, err := ParseSize(s)
+		if err != nil {
+			t.Errorf("unable to parse %q: %v", s, err)
+			continue
+		}
+		if size != expected {
+			t.Errorf("expected %q to be %d bytes but got %d", s, expected, size)
+		}
+	}
+
+	for _, s := range []string{"", "M", "ten", "-1", "10X"} {
+		if _, err := ParseSize(s); err == nil {
+			t.Errorf("expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2021, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]time.Time{
+		"36h":                  now.Add(-36 * time.Hour),
+		"7d":                   now.AddDate(0, 0, -7),
+		"2w":                   now.AddDate(0, 0, -14),
+		"2021-01-02T03:04:05Z": time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+		"2021-01-02":           time.Date(2021, 1, 2, 0, 0, 0, 0, time.Local),
+	}
+
+	for s, expected := range tests {
+		parsed, err := ParseTime(s, now)
+		if err != nil {
+			t.Errorf("unable to parse %q: %v", s, err)
+			continue
+		}
+		if !parsed.Equal(expected) {
+			t.Errorf("expected %q to be %v but got %v", s, expected, parsed)
+		}
+	}
+
+	if _, err := ParseTime("yesterday", now); err == nil {
+		t.Error("expected an unknown time to be rejected")
+	}
+}
+
+func TestParseFileType(t *testing.T) {
+	for _, fileType := range FileTypes {
+		parsed, err := ParseFileType(string(fileType))
+		if err != nil || parsed != fileType {
+			t.Errorf("expected %q to parse but got %q, %v", fileType, parsed, err)
+		}
+	}
+
+	if parsed, err := ParseFileType(""); err != nil || parsed != FileTypeRegular {
+		t.Errorf("expected the default file type to be %q but got %q, %v", FileTypeRegular, parsed, err)
+	}
+
+	if _, err := ParseFileType("socket"); err == nil {
+		t.Error("expected an unknown file type to be rejected")
+	}
+}
+
+// specialFileInfo describes a file that is not a regular file, like a named pipe
+type specialFileInfo struct {
+	mode os.FileMode
+}
+
+func (info specialFileInfo) Name() string       { return "special" }
+func (info specialFileInfo) Size() int64        { return 0 }
+func (info specialFileInfo) Mode() os.FileMode  { return info.mode }
+func (info specialFileInfo) ModTime() time.Time { return time.Time{} }
+func (info specialFileInfo) IsDir() bool        { return false }
+func (info specialFileInfo) Sys() interface{}   { return nil }
+
+func TestSpecialFilesAreOnlyCollectedWhenAskedFor(t *testing.T) {
+	for _, mode := range []os.FileMode{os.ModeNamedPipe, os.ModeSocket, os.ModeDevice, os.ModeDevice | os.ModeCharDevice} {
+		info := specialFileInfo{mode}
+
+		for _, fileType := range []FileType{"", FileTypeRegular, FileTypeNonEmpty} {
+			if !(FileCollectionOptions{Type: fileType}).filtered(info) {
+				t.Errorf("expected %v to be filtered out by type %q", mode, fileType)
+			}
+		}
+
+		if (FileCollectionOptions{Type: FileTypeAny}).filtered(info) {
+			t.Errorf("expected %v to be collected by type %q", mode, FileTypeAny)
+		}
+	}
+}
+
+func TestCollectFilesFilters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMuka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	files := []struct {
+		name    string
+		size    int
+		modTime time.Time
+	}{
+		{"empty", 0, now},
+		{"small", 10, now.Add(-48 * time.Hour)},
+		{"large", 2000, now.Add(-10 * 24 * time.Hour)},
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		if err := ioutil.WriteFile(path, []byte(strings.Repeat("x", f.size)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, f.modTime, f.modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		options  FileCollectionOptions
+		expected []string
+	}{
+		{FileCollectionOptions{}, []string{"empty", "large", "small"}},
+		{FileCollectionOptions{Type: FileTypeRegular}, []string{"empty", "large", "small"}},
+		{FileCollectionOptions{Type: FileTypeNonEmpty}, []string{"large", "small"}},
+		{FileCollectionOptions{MinSize: 10}, []string{"large", "small"}},
+		{FileCollectionOptions{MaxSize: 10}, []string{"empty", "small"}},
+		{FileCollectionOptions{MinSize: 1, MaxSize: 1000}, []string{"small"}},
+		{FileCollectionOptions{NewerThan: now.Add(-24 * time.Hour)}, []string{"empty"}},
+		{FileCollectionOptions{OlderThan: now.Add(-24 * time.Hour)}, []string{"large", "small"}},
+		{FileCollectionOptions{NewerThan: now.Add(-7 * 24 * time.Hour), OlderThan: now.Add(-time.Hour)}, []string{"small"}},
+	}
+
+	for i, test := range tests {
+		test.options.DirectoryToSearch = dir
+		d, err := CollectFiles(test.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, f := range d.EncounteredFiles {
+			names = append(names, filepath.Base(f.AbsolutePath))
+		}
+		sort.Strings(names)
+
+		if !reflect.DeepEqual(test.expected, names) {
+			t.Errorf("test %d: expected %v but got %v", i+1, test.expected, names)
+		}
+	}
+}
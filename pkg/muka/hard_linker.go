@@ -0,0 +1,74 @@
+package muka
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// hardLinker replaces duplicates with hard links to their original
+type hardLinker struct {
+	journal *Journal
+}
+
+func (impl hardLinker) Delete(duplicate, original FileHash) error {
+	originalInfo, err := os.Stat(original.AbsolutePath)
+	if err != nil {
+		return err
+	}
+
+	duplicateInfo, err := os.Lstat(duplicate.AbsolutePath)
+	if err != nil {
+		return err
+	}
+
+	if os.SameFile(originalInfo, duplicateInfo) {
+		return fmt.Errorf("%q is already a hard link to %q", duplicate.AbsolutePath, original.AbsolutePath)
+	}
+
+	originalDevice, _, ok := fileIdentity(originalInfo)
+	duplicateDevice, _, _ := fileIdentity(duplicateInfo)
+	if ok && originalDevice != duplicateDevice {
+		return fmt.Errorf("%q and %q are on different filesystems", duplicate.AbsolutePath, original.AbsolutePath)
+	}
+
+	err = replaceAtomically(duplicate.AbsolutePath, func(tmp string) error {
+		return os.Link(original.AbsolutePath, tmp)
+	})
+	if err != nil {
+		return err
+	}
+
+	recordOperation(impl.journal, ActionHardLink, duplicate, original, "")
+
+	return nil
+}
+
+// replaceAtomically has create make a new file at a temporary path next to path
+// and then renames it over path, so path is never missing even if the process dies midway
+func replaceAtomically(path string, create func(tmp string) error) error {
+	dir, base := filepath.Split(path)
+	for {
+		suffix := make([]byte, 8)
+		if _, err := rand.Read(suffix); err != nil {
+			return err
+		}
+
+		tmp := filepath.Join(dir, fmt.Sprintf(".%s.muka-%s", base, hex.EncodeToString(suffix)))
+		if err := create(tmp); err != nil {
+			if os.IsExist(err) {
+				continue
+			}
+			return err
+		}
+
+		if err := os.Rename(tmp, path); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,94 @@
+package muka
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// makeDuplicates creates an original and a duplicate file with the same contents in a temporary directory
+func makeDuplicates(t *testing.T) (string, FileHash, FileHash) {
+	dir, err := ioutil.TempDir("", "TestMuka")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hashes []FileHash
+	for _, name := range []string{"original.txt", "duplicate.txt"} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte("contents"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, fileHashOf(path))
+	}
+
+	return dir, hashes[0], hashes[1]
+}
+
+func TestHardLinkerReplacesDuplicateWithLink(t *testing.T) {
+	dir, original, duplicate := makeDuplicates(t)
+	defer os.RemoveAll(dir)
+
+	deleter, err := NewDeleter(DeleterOptions{Action: ActionHardLink})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := deleter.Delete(duplicate, original); err != nil {
+		t.Fatal(err)
+	}
+
+	originalInfo, err := os.Stat(original.AbsolutePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	duplicateInfo, err := os.Stat(duplicate.AbsolutePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !os.SameFile(originalInfo, duplicateInfo) {
+		t.Error("the duplicate should be a hard link to the original")
+	}
+
+	// linking again has nothing left to reclaim
+	if err := deleter.Delete(duplicate, original); err == nil {
+		t.Error("linking an existing hard link should fail")
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqualsI(t, 2, len(files))
+}
+
+func TestHardLinkerOnDryRunShouldKeepFile(t *testing.T) {
+	dir, original, duplicate := makeDuplicates(t)
+	defer os.RemoveAll(dir)
+
+	deleter, err := NewDeleter(DeleterOptions{Action: ActionHardLink, IsDryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := deleter.Delete(duplicate, original); err != nil {
+		t.Fatal(err)
+	}
+
+	originalInfo, err := os.Stat(original.AbsolutePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	duplicateInfo, err := os.Stat(duplicate.AbsolutePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if os.SameFile(originalInfo, duplicateInfo) {
+		t.Error("dry run should not link files")
+	}
+}
@@ -0,0 +1,281 @@
+package muka
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const hashCacheVersion = 1
+
+// HashCacheEntry holds the hashes remembered by the HashCache for a single file
+type HashCacheEntry struct {
+	Path      string `json:"path"`
+	Device    uint64 `json:"device"`
+	Inode     uint64 `json:"inode"`
+	Size      int64  `json:"size"`
+	ModTime   int64  `json:"mtime"`
+	Algorithm string `json:"algorithm"`
+	// Hash is the hash of the whole file. It is empty when only the partial hash is known.
+	Hash string `json:"hash,omitempty"`
+	// PartialHash is the hash of the first and last PartialBytes bytes of the file
+	PartialHash  string `json:"partial_hash,omitempty"`
+	PartialBytes int64  `json:"partial_bytes,omitempty"`
+}
+
+type hashCacheKey struct {
+	device    uint64
+	inode     uint64
+	algorithm string
+}
+
+type hashCacheFile struct {
+	Version int              `json:"version"`
+	Entries []HashCacheEntry `json:"entries"`
+}
+
+// HashCache is an on-disk cache of file hashes keyed by device and inode. Both full hashes and the partial
+// hashes that rule files out before they are fully hashed are cached.
+// A cached hash is only reused while the size and modification time of the file are unchanged.
+// A HashCache is not safe for concurrent use.
+type HashCache struct {
+	path    string
+	entries map[hashCacheKey]HashCacheEntry
+}
+
+// HashCacheStats summarizes the contents of a HashCache
+type HashCacheStats struct {
+	Path             string
+	SizeInBytes      int64
+	EntryCount       int
+	CountByAlgorithm map[string]int
+}
+
+func (s HashCacheStats) String() string {
+
+	algorithms := make([]string, 0, len(s.CountByAlgorithm))
+	for algorithm := range s.CountByAlgorithm {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Cache: %s (%.2f KB)\n", s.Path, float64(s.SizeInBytes)/1000.0)
+	fmt.Fprintf(&b, "Entries: %d\n", s.EntryCount)
+	for _, algorithm := range algorithms {
+		fmt.Fprintf(&b, "  %s: %d\n", algorithm, s.CountByAlgorithm[algorithm])
+	}
+
+	return b.String()
+}
+
+// DefaultHashCachePath returns the location of the hash cache under the user cache directory,
+// which is $XDG_CACHE_HOME/muka on Linux
+func DefaultHashCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "muka", "hashes.json"), nil
+}
+
+// LoadHashCache reads the cache stored at path. A missing file yields an empty cache.
+func LoadHashCache(path string) (*HashCache, error) {
+	cache := &HashCache{
+		path:    path,
+		entries: make(map[hashCacheKey]HashCacheEntry),
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f hashCacheFile
+	if err := json.Unmarshal(contents, &f); err != nil {
+		return nil, fmt.Errorf("reading hash cache %q: %v", path, err)
+	}
+
+	if f.Version != hashCacheVersion {
+		// an unknown format is discarded rather than misinterpreted
+		return cache, nil
+	}
+
+	for _, entry := range f.Entries {
+		cache.entries[hashCacheKey{entry.Device, entry.Inode, entry.Algorithm}] = entry
+	}
+
+	return cache, nil
+}
+
+// Lookup returns the cached hash of the file computed with the algorithm, if the file
+// has not changed since it was cached
+func (cache *HashCache) Lookup(fd FileData, algorithm string) (string, bool) {
+	entry, exists := cache.lookup(fd, algorithm)
+	if !exists || entry.Hash == "" {
+		return "", false
+	}
+
+	return entry.Hash, true
+}
+
+// LookupPartial returns the cached hash of the first and last n bytes of the file computed with the
+// algorithm, if the file has not changed since it was cached
+func (cache *HashCache) LookupPartial(fd FileData, algorithm string, n int64) (string, bool) {
+	entry, exists := cache.lookup(fd, algorithm)
+	if !exists || entry.PartialHash == "" || entry.PartialBytes != n {
+		return "", false
+	}
+
+	return entry.PartialHash, true
+}
+
+// lookup returns the entry of the file for the algorithm unless the file changed since it was cached
+func (cache *HashCache) lookup(fd FileData, algorithm string) (HashCacheEntry, bool) {
+	if fd.Device == 0 && fd.Inode == 0 {
+		return HashCacheEntry{}, false
+	}
+
+	entry, exists := cache.entries[hashCacheKey{fd.Device, fd.Inode, algorithm}]
+	if !exists || entry.Size != fd.SizeInBytes || entry.ModTime != fd.ModTime.UnixNano() {
+		return HashCacheEntry{}, false
+	}
+
+	return entry, true
+}
+
+// Store remembers the hash, replacing any hash previously cached for the same file and algorithm.
+// The partial hash of the file is kept as long as the file did not change.
+func (cache *HashCache) Store(hash FileHash) {
+	if hash.Device == 0 && hash.Inode == 0 {
+		return
+	}
+
+	entry, _ := cache.lookup(hash.FileData, hash.Algorithm)
+	entry.Hash = hash.Hash
+	cache.store(hash.FileData, hash.Algorithm, entry)
+}
+
+// StorePartial remembers the hash of the first and last n bytes of the file computed with the algorithm.
+// The full hash of the file is kept as long as the file did not change.
+func (cache *HashCache) StorePartial(fd FileData, algorithm string, n int64, partialHash string) {
+	if fd.Device == 0 && fd.Inode == 0 {
+		return
+	}
+
+	entry, _ := cache.lookup(fd, algorithm)
+	entry.PartialHash = partialHash
+	entry.PartialBytes = n
+	cache.store(fd, algorithm, entry)
+}
+
+// store caches the hashes of entry for the file as it is now
+func (cache *HashCache) store(fd FileData, algorithm string, entry HashCacheEntry) {
+	entry.Path = fd.AbsolutePath
+	entry.Device = fd.Device
+	entry.Inode = fd.Inode
+	entry.Size = fd.SizeInBytes
+	entry.ModTime = fd.ModTime.UnixNano()
+	entry.Algorithm = algorithm
+
+	cache.entries[hashCacheKey{fd.Device, fd.Inode, algorithm}] = entry
+}
+
+// Prune removes the entries whose file no longer exists or has changed since it was cached
+// and returns the number of entries removed
+func (cache *HashCache) Prune() int {
+
+	pruned := 0
+	for key, entry := range cache.entries {
+		info, err := os.Stat(entry.Path)
+		if err == nil {
+			device, inode, _ := fileIdentity(info)
+			if device == entry.Device && inode == entry.Inode &&
+				info.Size() == entry.Size && info.ModTime().UnixNano() == entry.ModTime {
+				continue
+			}
+		}
+
+		delete(cache.entries, key)
+		pruned++
+	}
+
+	return pruned
+}
+
+// Clear removes every entry from the cache
+func (cache *HashCache) Clear() {
+
+	cache.entries = make(map[hashCacheKey]HashCacheEntry)
+}
+
+// Stats summarizes the cache
+func (cache *HashCache) Stats() HashCacheStats {
+
+	stats := HashCacheStats{
+		Path:             cache.path,
+		EntryCount:       len(cache.entries),
+		CountByAlgorithm: make(map[string]int),
+	}
+
+	if info, err := os.Stat(cache.path); err == nil {
+		stats.SizeInBytes = info.Size()
+	}
+
+	for _, entry := range cache.entries {
+		stats.CountByAlgorithm[entry.Algorithm]++
+	}
+
+	return stats
+}
+
+// Save writes the cache back to disk. The cache is written to a temporary file
+// first so that an interrupted save never leaves a truncated cache behind.
+func (cache *HashCache) Save() error {
+
+	f := hashCacheFile{
+		Version: hashCacheVersion,
+		Entries: make([]HashCacheEntry, 0, len(cache.entries)),
+	}
+	for _, entry := range cache.entries {
+		f.Entries = append(f.Entries, entry)
+	}
+	sort.Slice(f.Entries, func(i, j int) bool {
+		return f.Entries[i].Path < f.Entries[j].Path
+	})
+
+	contents, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(cache.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, ".hashes-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), cache.path)
+}
@@ -0,0 +1,168 @@
+package muka
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHashCacheRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMuka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "muka", "hashes.json")
+	cache, err := LoadHashCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := CollectFiles(FileCollectionOptions{
+		DirectoryToSearch: getTestingDir("small"),
+		HashCache:         cache,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := LoadHashCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqualsI(t, len(d.HashedFiles), reloaded.Stats().EntryCount)
+	for _, f := range d.HashedFiles {
+		h, exists := reloaded.Lookup(f.FileData, f.Algorithm)
+		if !exists || h != f.Hash {
+			t.Errorf("expected %q to be cached as %q but got %q", f.AbsolutePath, f.Hash, h)
+		}
+	}
+}
+
+func TestCollectFilesReusesCachedHashes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMuka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache, err := LoadHashCache(filepath.Join(dir, "hashes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := CollectFiles(FileCollectionOptions{
+		DirectoryToSearch: getTestingDir("small"),
+		HashCache:         cache,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.HashedFiles[0].Device == 0 && d.HashedFiles[0].Inode == 0 {
+		t.Skip("file identities are not available on this platform")
+	}
+
+	// a hash that could only have come from the cache
+	cached := d.HashedFiles[0]
+	cached.Hash = "cached"
+	cache.Store(cached)
+
+	d, err = CollectFiles(FileCollectionOptions{
+		DirectoryToSearch: getTestingDir("small"),
+		HashCache:         cache,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.HashedFiles[0].Hash != "cached" {
+		t.Errorf("expected the cached hash but got %q", d.HashedFiles[0].Hash)
+	}
+}
+
+func TestHashCachePruneRemovesMissingFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMuka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache, err := LoadHashCache(filepath.Join(dir, "hashes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache.Store(FileHash{
+		FileData: FileData{
+			AbsolutePath: filepath.Join(dir, "missing.txt"),
+			Device:       1,
+			Inode:        1,
+		},
+		Hash:      "abcdefg",
+		Algorithm: "sha1",
+	})
+
+	assertEqualsI(t, 1, cache.Prune())
+	assertEqualsI(t, 0, cache.Stats().EntryCount)
+}
+
+func TestCollectFilesReusesCachedPartialHashes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMuka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// same size but different ends so both are ruled out by the partial hash
+	for name, contents := range map[string]string{"a": "aaaa-middle-aaaa", "b": "bbbb-middle-bbbb"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cache, err := LoadHashCache(filepath.Join(dir, "cache", "hashes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := FileCollectionOptions{
+		DirectoryToSearch: dir,
+		PartialHashBytes:  4,
+		HashCache:         cache,
+	}
+	d, err := CollectFiles(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqualsI(t, 0, len(d.HashedFiles))
+	if d.EncounteredFiles[0].Device == 0 && d.EncounteredFiles[0].Inode == 0 {
+		t.Skip("file identities are not available on this platform")
+	}
+
+	hasher := DefaultHasher()
+	for _, fd := range d.EncounteredFiles {
+		if _, exists := cache.LookupPartial(fd, hasher.Name(), 4); !exists {
+			t.Errorf("expected the partial hash of %q to be cached", fd.AbsolutePath)
+		}
+
+		// partial hashes that could only have come from the cache
+		cache.StorePartial(fd, hasher.Name(), 4, "cached")
+	}
+
+	d, err = CollectFiles(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the cached partial hashes match so both files are fully hashed
+	assertEqualsI(t, 2, len(d.HashedFiles))
+}
@@ -0,0 +1,101 @@
+package muka
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"sort"
+	"sync"
+
+	"github.com/cespare/xxhash/v2"
+	"golang.org/x/crypto/blake2b"
+)
+
+// DefaultHasherName is the name of the algorithm used when none is specified
+const DefaultHasherName = "sha1"
+
+// Hasher creates the hash functions used to fingerprint file contents
+type Hasher interface {
+	// Name is the name the algorithm is registered and recorded under
+	Name() string
+	// New returns a new hash.Hash computing the checksum
+	New() hash.Hash
+}
+
+type namedHasher struct {
+	name string
+	new  func() hash.Hash
+}
+
+func (h namedHasher) Name() string {
+
+	return h.name
+}
+
+func (h namedHasher) New() hash.Hash {
+
+	return h.new()
+}
+
+var (
+	hashersMu sync.RWMutex
+	hashers   = make(map[string]Hasher)
+)
+
+func init() {
+	RegisterHasher(namedHasher{name: "sha1", new: sha1.New})
+	RegisterHasher(namedHasher{name: "sha256", new: sha256.New})
+	RegisterHasher(namedHasher{name: "blake2b", new: func() hash.Hash {
+		// New256 only fails when given a key that is too long
+		h, _ := blake2b.New256(nil)
+		return h
+	}})
+	RegisterHasher(namedHasher{name: "xxhash", new: func() hash.Hash {
+		return xxhash.New()
+	}})
+}
+
+// RegisterHasher makes a Hasher available by its name, replacing any Hasher
+// previously registered under the same name
+func RegisterHasher(hasher Hasher) {
+	hashersMu.Lock()
+	defer hashersMu.Unlock()
+
+	hashers[hasher.Name()] = hasher
+}
+
+// LookupHasher returns the Hasher registered under name
+func LookupHasher(name string) (Hasher, error) {
+	hashersMu.RLock()
+	defer hashersMu.RUnlock()
+
+	hasher, exists := hashers[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown hash algorithm %q", name)
+	}
+
+	return hasher, nil
+}
+
+// HasherNames returns the sorted names of all registered Hashers
+func HasherNames() []string {
+	hashersMu.RLock()
+	defer hashersMu.RUnlock()
+
+	names := make([]string, 0, len(hashers))
+	for name := range hashers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// DefaultHasher returns the Hasher used when none is specified
+func DefaultHasher() Hasher {
+	// the default hasher is registered in init so it always exists
+	hasher, _ := LookupHasher(DefaultHasherName)
+
+	return hasher
+}
@@ -0,0 +1,60 @@
+package muka
+
+import (
+	"testing"
+)
+
+func TestLookupUnknownHasher(t *testing.T) {
+	if _, err := LookupHasher("md4"); err == nil {
+		t.Error("looking up an unregistered algorithm should fail")
+	}
+}
+
+func TestEveryHasherFindsTheSameDuplicates(t *testing.T) {
+	for _, name := range HasherNames() {
+		hasher, err := LookupHasher(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d, err := CollectFiles(FileCollectionOptions{
+			DirectoryToSearch: getTestingDir("small"),
+			Hasher:            hasher,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, f := range d.HashedFiles {
+			if f.Algorithm != name {
+				t.Errorf("expected %q to be hashed with %q but got %q", f.AbsolutePath, name, f.Algorithm)
+			}
+		}
+
+		duplicates := FindDuplicateFiles(d)
+		assertEqualsI(t, 1, len(duplicates))
+		assertEqualsI(t, 2, len(duplicates[0].Duplicates))
+	}
+}
+
+func TestDuplicatesAreNotMixedAcrossAlgorithms(t *testing.T) {
+	fileHashes := []FileHash{
+		{
+			FileData: FileData{
+				AbsolutePath: "file1.txt",
+			},
+			Hash:      "abcdefg",
+			Algorithm: "sha1",
+		},
+		{
+			FileData: FileData{
+				AbsolutePath: "file2.txt",
+			},
+			Hash:      "abcdefg",
+			Algorithm: "xxhash",
+		},
+	}
+
+	duplicateFiles := FindDuplicateFiles(Directory{HashedFiles: fileHashes})
+	assertEqualsI(t, 0, len(duplicateFiles))
+}
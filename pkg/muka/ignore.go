@@ -0,0 +1,163 @@
+package muka
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFileNames are the files whose patterns exclude paths from the search the way .gitignore does for git.
+// Patterns of later files take precedence over those of earlier ones in the same directory.
+var IgnoreFileNames = []string{".gitignore", ".ignore", ".mukaignore"}
+
+// gitDirName is the directory git keeps its objects in. Like git itself, the search never descends into it.
+const gitDirName = ".git"
+
+// ignorePattern is a single line of an ignore file
+type ignorePattern struct {
+	// base is the directory of the ignore file the pattern comes from
+	base string
+	// segments are the slash separated parts of the pattern
+	segments []string
+	negate   bool
+	dirOnly  bool
+	// anchored patterns match the path relative to base rather than just the name
+	anchored bool
+}
+
+// ignoreRules are the patterns that apply in a directory, in increasing order of precedence
+type ignoreRules []ignorePattern
+
+// parseIgnorePattern parses a line of an ignore file following the gitignore(5) format.
+// The second return value is false for blank lines and comments.
+func parseIgnorePattern(base, line string) (ignorePattern, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
+	}
+
+	pattern := ignorePattern{base: base}
+	if strings.HasPrefix(line, "!") {
+		pattern.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		pattern.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	// a separator anywhere but at the end ties the pattern to the directory of the ignore file
+	if strings.Contains(line, "/") {
+		pattern.anchored = true
+		line = strings.TrimLeft(line, "/")
+	}
+
+	if line == "" {
+		return ignorePattern{}, false
+	}
+
+	// path.Match negates character classes with '^' where gitignore uses '!'
+	line = strings.ReplaceAll(line, "[!", "[^")
+	pattern.segments = strings.Split(line, "/")
+
+	return pattern, true
+}
+
+// matches reports whether the pattern matches the file at path
+func (pattern ignorePattern) matches(filePath string, isDir bool) bool {
+	if pattern.dirOnly && !isDir {
+		return false
+	}
+
+	if !pattern.anchored {
+		matched, _ := path.Match(pattern.segments[0], filepath.Base(filePath))
+		return matched
+	}
+
+	rel, err := filepath.Rel(pattern.base, filePath)
+	if err != nil {
+		return false
+	}
+
+	return matchSegments(pattern.segments, strings.Split(filepath.ToSlash(rel), "/"))
+}
+
+// matchSegments matches path segments against pattern segments where "**" matches any number of segments
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+
+	if pattern[0] == "**" {
+		// a trailing "**" matches everything inside, but not the directory itself
+		if len(pattern) == 1 {
+			return len(segments) > 0
+		}
+
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+
+	if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+		return false
+	}
+
+	return matchSegments(pattern[1:], segments[1:])
+}
+
+// ignored reports whether the file at path is ignored. The last pattern matching the file decides.
+func (rules ignoreRules) ignored(filePath string, isDir bool) bool {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].matches(filePath, isDir) {
+			return !rules[i].negate
+		}
+	}
+
+	return false
+}
+
+// load returns the rules that apply in dir: those of its parents followed by the patterns of its own ignore files
+func (rules ignoreRules) load(dir string) (ignoreRules, error) {
+	loaded := rules
+	for _, name := range IgnoreFileNames {
+		f, err := os.Open(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// copy before appending so sibling directories never share the patterns of one another
+		if len(loaded) == len(rules) {
+			loaded = append(ignoreRules{}, rules...)
+		}
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if pattern, ok := parseIgnorePattern(dir, scanner.Text()); ok {
+				loaded = append(loaded, pattern)
+			}
+		}
+		f.Close()
+
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return loaded, nil
+}
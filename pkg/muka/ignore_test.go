@@ -0,0 +1,160 @@
+package muka
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	base := filepath.FromSlash("/repo")
+	var rules ignoreRules
+	for _, line := range []string{"# comment", "", "*.o", "!keep.o", "build/", "/top", "docs/**/draft.md", "cache/**", `\!bang`} {
+		if pattern, ok := parseIgnorePattern(base, line); ok {
+			rules = append(rules, pattern)
+		}
+	}
+	assertEqualsI(t, 7, len(rules))
+
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"a.o", false, true},
+		{"sub/a.o", false, true},
+		{"sub/keep.o", false, false},
+		{"build", true, true},
+		{"sub/build", true, true},
+		{"build", false, false},
+		{"top", false, true},
+		{"sub/top", false, false},
+		{"docs/draft.md", false, true},
+		{"docs/a/b/draft.md", false, true},
+		{"other/docs/draft.md", false, false},
+		{"cache", true, false},
+		{"cache/entry", false, true},
+		{"!bang", false, true},
+		{"bang", false, false},
+	}
+
+	for _, test := range tests {
+		if rules.ignored(filepath.Join(base, filepath.FromSlash(test.path)), test.isDir) != test.ignored {
+			t.Errorf("expected %q to be ignored: %t", test.path, test.ignored)
+		}
+	}
+}
+
+func TestCollectFilesHonorsIgnoreFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMuka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		".gitignore":        "build/\n*.log\n!keep.log\n/top.txt\ndocs/**/draft.md\n",
+		"build/out.bin":     "",
+		"a.log":             "",
+		"keep.log":          "",
+		"top.txt":           "",
+		"docs/a/draft.md":   "",
+		"docs/a/final.md":   "",
+		"sub/top.txt":       "",
+		"sub/b.log":         "",
+		"sub/x.tmp":         "",
+		"sub/y.tmp":         "",
+		"sub/.gitignore":    "*.tmp\n",
+		"sub/.ignore":       "!b.log\n",
+		"sub/.mukaignore":   "!x.tmp\n",
+		"other/.mukaignore": "*\n",
+		"other/hidden.txt":  "",
+		".git/HEAD":         "ref: refs/heads/master\n",
+		"sub/.git/config":   "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	collect := func(noIgnore bool) []string {
+		d, err := CollectFiles(FileCollectionOptions{DirectoryToSearch: dir, NoIgnore: noIgnore})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, f := range d.EncounteredFiles {
+			rel, err := filepath.Rel(dir, f.AbsolutePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, filepath.ToSlash(rel))
+		}
+		sort.Strings(names)
+
+		return names
+	}
+
+	expected := []string{".gitignore", "docs/a/final.md", "keep.log", "sub/.gitignore", "sub/.ignore", "sub/.mukaignore", "sub/b.log", "sub/top.txt", "sub/x.tmp"}
+	if names := collect(false); !reflect.DeepEqual(expected, names) {
+		t.Errorf("expected %v but got %v", expected, names)
+	}
+
+	if names := collect(true); len(names) != len(files) {
+		t.Errorf("expected every file to be collected but got %s", strings.Join(names, ", "))
+	}
+}
+
+func TestNestedRootsPrunedByTheOuterWalkAreStillSearched(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMuka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		".gitignore":   "build/\n",
+		"build/a.bin":  "contents",
+		"build/b.bin":  "contents",
+		"library/a.md": "archived",
+		"vendor/b.md":  "archived",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// build is ignored and library excluded by the walk of dir, but both are roots of their own
+	d, err := CollectFiles(FileCollectionOptions{
+		DirectoryToSearch:    dir,
+		DirectoriesToSearch:  []string{filepath.Join(dir, "build")},
+		ReferenceDirectories: []string{filepath.Join(dir, "library")},
+		ExcludePatterns:      []string{"library"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	duplicates := FindDuplicateFiles(d)
+	assertEqualsI(t, 2, len(duplicates))
+	for _, dup := range duplicates {
+		if filepath.Base(dup.Original.AbsolutePath) == "a.md" && !dup.Original.IsReference {
+			t.Errorf("expected the reference file to be the original but got %q", dup.Original.AbsolutePath)
+		}
+	}
+}
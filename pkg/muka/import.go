@@ -0,0 +1,242 @@
+package muka
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ImportFormat names another duplicate finder whose results can be imported
+type ImportFormat string
+
+const (
+	// ImportFdupes is the default output of fdupes: groups of paths separated by blank lines
+	ImportFdupes ImportFormat = "fdupes"
+	// ImportJdupes is the default output of jdupes, which is the same as the one of fdupes
+	ImportJdupes ImportFormat = "jdupes"
+	// ImportRmlint is the JSON output of rmlint, as written by 'rmlint -o json'
+	ImportRmlint ImportFormat = "rmlint"
+)
+
+// ImportFormats lists every supported ImportFormat
+var ImportFormats = []ImportFormat{ImportFdupes, ImportJdupes, ImportRmlint}
+
+// sizeLinePattern matches the size fdupes and jdupes write before each group when asked to with -S
+var sizeLinePattern = regexp.MustCompile(`^\d+ bytes? each:$`)
+
+// ParseDuplicateGroups reads the groups of duplicate paths written by another duplicate finder
+func ParseDuplicateGroups(r io.Reader, from ImportFormat) ([][]string, error) {
+	switch from {
+	case ImportFdupes, ImportJdupes:
+		return parseFdupesGroups(r)
+	case ImportRmlint:
+		return parseRmlintGroups(r)
+	default:
+		return nil, fmt.Errorf("unknown import format %q", from)
+	}
+}
+
+func parseFdupesGroups(r io.Reader) ([][]string, error) {
+	var groups [][]string
+	var group []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			if len(group) > 0 {
+				groups = append(groups, group)
+			}
+			group = nil
+			continue
+		}
+
+		if sizeLinePattern.MatchString(line) {
+			continue
+		}
+
+		group = append(group, line)
+	}
+
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+
+	return groups, scanner.Err()
+}
+
+// rmlintEntry is the part of an rmlint JSON entry that is imported. The header and the footer of
+// the output have no type.
+type rmlintEntry struct {
+	Type       string `json:"type"`
+	Path       string `json:"path"`
+	Checksum   string `json:"checksum"`
+	IsOriginal bool   `json:"is_original"`
+}
+
+func parseRmlintGroups(r io.Reader) ([][]string, error) {
+	var entries []rmlintEntry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, err
+	}
+
+	var groups [][]string
+	indices := make(map[string]int)
+	for _, entry := range entries {
+		if entry.Type != "duplicate_file" {
+			continue
+		}
+
+		i, exists := indices[entry.Checksum]
+		if !exists {
+			i = len(groups)
+			indices[entry.Checksum] = i
+			groups = append(groups, nil)
+		}
+
+		// the file rmlint would keep comes first so it is kept by default here too
+		if entry.IsOriginal {
+			groups[i] = append([]string{entry.Path}, groups[i]...)
+		} else {
+			groups[i] = append(groups[i], entry.Path)
+		}
+	}
+
+	return groups, nil
+}
+
+// ImportFiles hashes the files of groups read by ParseDuplicateGroups so that FindDuplicateFiles can group
+// them again. Files that are missing or that differ from the other files of their group are logged and,
+// since they are only grouped with files of the same hash, never treated as duplicates.
+// The hasher, parallelism and directory rules of options apply as they do to CollectFiles.
+func ImportFiles(groups [][]string, options FileCollectionOptions) (Directory, error) {
+	preferred, err := resolveDirs(options.PreferredDirectories)
+	if err != nil {
+		return Directory{}, err
+	}
+
+	protected, err := resolveDirs(options.ProtectedDirectories)
+	if err != nil {
+		return Directory{}, err
+	}
+
+	roots, references, err := options.roots()
+	if err != nil {
+		return Directory{}, err
+	}
+
+	var fileData []FileData
+	// fileIndices maps the paths of every group to the position of their file in fileData
+	fileIndices := make([][]int, len(groups))
+	seen := make(map[string]int)
+	inodes := make(map[[2]uint64]int)
+	for g, group := range groups {
+		for _, path := range group {
+			absolutePath, err := filepath.Abs(path)
+			if err != nil {
+				return Directory{}, err
+			}
+
+			if i, exists := seen[absolutePath]; exists {
+				fileIndices[g] = append(fileIndices[g], i)
+				continue
+			}
+
+			info, err := os.Stat(absolutePath)
+			if err != nil {
+				log.Printf("unable to import %q: %v", absolutePath, err)
+				continue
+			}
+
+			if !info.Mode().IsRegular() {
+				log.Printf("unable to import %q: not a regular file", absolutePath)
+				continue
+			}
+
+			rootIndex := deepestRoot(absolutePath, roots)
+			_, isPreferred := underAny(absolutePath, preferred)
+			_, isProtected := underAny(absolutePath, protected)
+
+			device, inode, ok := fileIdentity(info)
+			if ok {
+				if i, linked := inodes[[2]uint64{device, inode}]; linked {
+					linkedFile := &fileData[i]
+					linkedFile.HardLinks = append(linkedFile.HardLinks, absolutePath)
+					linkedFile.IsReference = linkedFile.IsReference || references[rootIndex]
+					linkedFile.IsPreferred = linkedFile.IsPreferred || isPreferred
+					linkedFile.IsProtected = linkedFile.IsProtected || isProtected
+					seen[absolutePath] = i
+					fileIndices[g] = append(fileIndices[g], i)
+					continue
+				}
+				inodes[[2]uint64{device, inode}] = len(fileData)
+			}
+
+			seen[absolutePath] = len(fileData)
+			fileIndices[g] = append(fileIndices[g], len(fileData))
+			fileData = append(fileData, FileData{
+				AbsolutePath: absolutePath,
+				SizeInBytes:  info.Size(),
+				ModTime:      info.ModTime(),
+				Device:       device,
+				Inode:        inode,
+				Links:        linkCount(info),
+				RootIndex:    rootIndex,
+				IsReference:  references[rootIndex],
+				IsPreferred:  isPreferred,
+				IsProtected:  isProtected,
+			})
+		}
+	}
+
+	parallelism := options.Parallelism
+	if parallelism < 1 {
+		parallelism = DefaultParallelism()
+	}
+
+	hasher := options.Hasher
+	if hasher == nil {
+		hasher = DefaultHasher()
+	}
+
+	hashes := make([]string, len(fileData))
+	forEachParallel(len(fileData), parallelism, func(i int) {
+		hash, err := hashFile(hasher, fileData[i].AbsolutePath)
+		if err != nil {
+			log.Printf("unable to hash %q: %v", fileData[i].AbsolutePath, err)
+			return
+		}
+		hashes[i] = hash
+	})
+
+	for _, indices := range fileIndices {
+		if len(indices) < 2 {
+			continue
+		}
+
+		for _, i := range indices[1:] {
+			if first := indices[0]; hashes[i] != "" && hashes[first] != "" && hashes[i] != hashes[first] {
+				log.Printf("%q and %q were imported as duplicates but their contents differ",
+					fileData[first].AbsolutePath, fileData[i].AbsolutePath)
+			}
+		}
+	}
+
+	var hashedFiles []FileHash
+	for i, hash := range hashes {
+		if hash != "" {
+			hashedFiles = append(hashedFiles, FileHash{FileData: fileData[i], Hash: hash, Algorithm: hasher.Name()})
+		}
+	}
+
+	return Directory{
+		EncounteredFiles: fileData,
+		HashedFiles:      hashedFiles,
+	}, nil
+}
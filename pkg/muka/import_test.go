@@ -0,0 +1,139 @@
+package muka
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFdupesGroups(t *testing.T) {
+	output := "/a\n/b\n\n12 bytes each:\r\n/c d\r\n/e\r\n\r\n\n/f\n/g"
+
+	for _, from := range []ImportFormat{ImportFdupes, ImportJdupes} {
+		groups, err := ParseDuplicateGroups(strings.NewReader(output), from)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := [][]string{{"/a", "/b"}, {"/c d", "/e"}, {"/f", "/g"}}
+		if !reflect.DeepEqual(expected, groups) {
+			t.Errorf("expected %v but got %v", expected, groups)
+		}
+	}
+}
+
+func TestParseRmlintGroups(t *testing.T) {
+	output := `[
+		{"description": "rmlint json-dump of lint files", "cwd": "/"},
+		{"type": "duplicate_file", "path": "/b", "checksum": "1", "is_original": false},
+		{"type": "duplicate_file", "path": "/a", "checksum": "1", "is_original": true},
+		{"type": "emptyfile", "path": "/empty", "checksum": "", "is_original": false},
+		{"type": "duplicate_file", "path": "/c", "checksum": "2", "is_original": true},
+		{"type": "duplicate_file", "path": "/d", "checksum": "2", "is_original": false},
+		{"type": "duplicate_file", "path": "/e", "checksum": "1", "is_original": false},
+		{"aborted": false, "progress": 100}
+	]`
+
+	groups, err := ParseDuplicateGroups(strings.NewReader(output), ImportRmlint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]string{{"/a", "/b", "/e"}, {"/c", "/d"}}
+	if !reflect.DeepEqual(expected, groups) {
+		t.Errorf("expected %v but got %v", expected, groups)
+	}
+}
+
+func TestParseUnknownImportFormat(t *testing.T) {
+	if _, err := ParseDuplicateGroups(strings.NewReader(""), ImportFormat("dupeguru")); err == nil {
+		t.Error("expected an unknown import format to be rejected")
+	}
+}
+
+func TestImportFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMuka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{"a": "same", "b": "same", "c": "different", "d": "same"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+	groups := [][]string{
+		{path("b"), path("a"), path("c"), path("missing")},
+		{path("d"), path("a")},
+	}
+
+	d, err := ImportFiles(groups, FileCollectionOptions{DirectoryToSearch: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqualsI(t, 4, len(d.EncounteredFiles))
+	assertEqualsI(t, 4, len(d.HashedFiles))
+
+	// the files that differ are left out and the order of the import picks the original
+	duplicates := FindDuplicateFiles(d)
+	assertEqualsI(t, 1, len(duplicates))
+	if duplicates[0].Original.AbsolutePath != path("b") {
+		t.Errorf("expected %q to be the original but got %q", path("b"), duplicates[0].Original.AbsolutePath)
+	}
+	assertEqualsI(t, 2, len(duplicates[0].Duplicates))
+
+	deletedFiles := ForceDelete(duplicates, MakeDeleter(false))
+	assertEqualsI(t, 2, len(deletedFiles))
+	for _, name := range []string{"a", "d"} {
+		if FileExists(path(name)) {
+			t.Errorf("%q should have been deleted", name)
+		}
+	}
+}
+
+func TestFdupesOutputCanBeImported(t *testing.T) {
+	var b strings.Builder
+	var reports strings.Builder
+	writer, err := NewDuplicateWriter(&b, &reports, FormatFdupes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dup := range outputDuplicates() {
+		if err := writer.WriteGroup(dup); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.WriteReport(Report{CollectedFileCount: 6}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.String() != "/a\n/b\n/c\n\n/e\n/f\n\n" {
+		t.Errorf("unexpected fdupes output %q", b.String())
+	}
+	if !strings.Contains(reports.String(), "Files Scanned: 6") {
+		t.Error("expected the report to be written on its own")
+	}
+
+	groups, err := ParseDuplicateGroups(strings.NewReader(b.String()), ImportFdupes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]string{{"/a", "/b", "/c"}, {"/e", "/f"}}
+	if !reflect.DeepEqual(expected, groups) {
+		t.Errorf("expected %v but got %v", expected, groups)
+	}
+}
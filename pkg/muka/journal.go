@@ -0,0 +1,325 @@
+package muka
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// JournalEntry records a single operation performed on a duplicate
+type JournalEntry struct {
+	// Run identifies the run of muka that performed the operation
+	Run       string    `json:"run,omitempty"`
+	Time      time.Time `json:"time"`
+	Operation Action    `json:"operation"`
+	Path      string    `json:"path"`
+	Original  string    `json:"original"`
+	Hash      string    `json:"hash"`
+	Algorithm string    `json:"algorithm"`
+	// Destination is where the file was moved to by ActionTrash and ActionQuarantine
+	Destination string `json:"destination,omitempty"`
+}
+
+// Journal is an append-only log of the operations performed on duplicates.
+// A nil Journal records nothing.
+type Journal struct {
+	path string
+	// run tags every entry recorded through this Journal so the operations of a run are undone together
+	run string
+}
+
+// UndoResult describes the outcome of undoing the operations of a journal
+type UndoResult struct {
+	Undone       []JournalEntry
+	Irreversible []JournalEntry
+	Failed       []JournalEntry
+}
+
+// DefaultJournalPath returns the location of the journal under $XDG_STATE_HOME/muka
+// falling back on ~/.local/state/muka
+func DefaultJournalPath() (string, error) {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+
+	return filepath.Join(stateHome, "muka", "journal.jsonl"), nil
+}
+
+// NewJournal Journal constructor. The file at path is created on the first recorded operation.
+// Every Journal starts a new run.
+func NewJournal(path string) *Journal {
+
+	return &Journal{path: path, run: fmt.Sprintf("%s-%d", time.Now().UTC().Format("20060102T150405.000000000Z"), os.Getpid())}
+}
+
+// Path returns the location of the journal
+func (journal *Journal) Path() string {
+
+	return journal.path
+}
+
+// Record appends the entry to the journal as part of the current run unless it belongs to one already
+func (journal *Journal) Record(entry JournalEntry) error {
+	if journal == nil {
+		return nil
+	}
+
+	if entry.Run == "" {
+		entry.Run = journal.run
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(journal.path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(journal.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Entries reads every entry of the journal in the order they were recorded.
+// A missing journal has no entries.
+func (journal *Journal) Entries() ([]JournalEntry, error) {
+	f, err := os.Open(journal.path)
+	if os.IsNotExist(err) {
+		return []JournalEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", journal.path, line, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+// Replace rewrites the journal so that it only holds entries
+func (journal *Journal) Replace(entries []JournalEntry) error {
+
+	var contents []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		contents = append(append(contents, line...), '\n')
+	}
+
+	dir := filepath.Dir(journal.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, ".journal-*.jsonl")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), journal.path)
+}
+
+// Undo reverses the reversible operations of the most recent runs of the journal, most recent first.
+// Only runs holding reversible operations count, so the deletions of the runs that only deleted files
+// since are listed as irreversible along the way. When runs is less than 1 every run is undone.
+// Entries that were undone are removed from the journal while irreversible and failed entries are kept.
+func (journal *Journal) Undo(runs int) (UndoResult, error) {
+	entries, err := journal.Entries()
+	if err != nil {
+		return UndoResult{}, err
+	}
+
+	undoing := undoableRuns(entries, runs)
+
+	var result UndoResult
+	kept := make([]JournalEntry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if !undoing[entry.Run] {
+			kept = append(kept, entry)
+			continue
+		}
+
+		if entry.Operation == ActionDelete {
+			result.Irreversible = append(result.Irreversible, entry)
+			kept = append(kept, entry)
+			continue
+		}
+
+		if err := undo(entry); err != nil {
+			log.Printf("unable to undo %s of %q: %v", entry.Operation, entry.Path, err)
+			result.Failed = append(result.Failed, entry)
+			kept = append(kept, entry)
+			continue
+		}
+
+		result.Undone = append(result.Undone, entry)
+	}
+
+	// kept was filled most recent first
+	for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+		kept[i], kept[j] = kept[j], kept[i]
+	}
+
+	return result, journal.Replace(kept)
+}
+
+// undoableRuns returns the runs of entries that Undo goes through: the last count runs holding reversible
+// operations along with the runs that only deleted files since, or every run when count is less than 1.
+// Entries journaled before runs were recorded all belong to the same run.
+func undoableRuns(entries []JournalEntry, count int) map[string]bool {
+	// order holds the runs most recent first
+	var order []string
+	reversible := make(map[string]bool)
+	listed := make(map[string]bool)
+	for i := len(entries) - 1; i >= 0; i-- {
+		run := entries[i].Run
+		if !listed[run] {
+			listed[run] = true
+			order = append(order, run)
+		}
+		if entries[i].Operation != ActionDelete {
+			reversible[run] = true
+		}
+	}
+
+	runs := make(map[string]bool)
+	undoable := 0
+	for _, run := range order {
+		if count > 0 && undoable == count {
+			break
+		}
+
+		runs[run] = true
+		if reversible[run] {
+			undoable++
+		}
+	}
+
+	return runs
+}
+
+// undo reverses a single journaled operation
+func undo(entry JournalEntry) error {
+	switch entry.Operation {
+	case ActionTrash, ActionQuarantine:
+		if _, err := os.Lstat(entry.Path); err == nil {
+			return fmt.Errorf("%q already exists", entry.Path)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(entry.Path), 0755); err != nil {
+			return err
+		}
+
+		if err := moveFile(entry.Destination, entry.Path); err != nil {
+			return err
+		}
+
+		if entry.Operation == ActionTrash {
+			// the info file lives in the info directory next to the files directory
+			trashDir := filepath.Dir(filepath.Dir(entry.Destination))
+			infoPath := filepath.Join(trashDir, "info", filepath.Base(entry.Destination)+".trashinfo")
+			if err := os.Remove(infoPath); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+
+		return nil
+	case ActionHardLink:
+		info, err := os.Lstat(entry.Path)
+		if err != nil {
+			return err
+		}
+
+		originalInfo, err := os.Stat(entry.Original)
+		if err != nil {
+			return err
+		}
+
+		if !os.SameFile(info, originalInfo) {
+			return fmt.Errorf("%q is no longer a hard link to %q", entry.Path, entry.Original)
+		}
+
+		return replaceAtomically(entry.Path, func(tmp string) error {
+			return copyFile(entry.Path, tmp)
+		})
+	case ActionSymlink:
+		info, err := os.Lstat(entry.Path)
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink == 0 {
+			return fmt.Errorf("%q is no longer a symbolic link", entry.Path)
+		}
+
+		// copying through the link copies the original it points to
+		return replaceAtomically(entry.Path, func(tmp string) error {
+			return copyFile(entry.Path, tmp)
+		})
+	default:
+		return fmt.Errorf("unknown operation %q", entry.Operation)
+	}
+}
+
+// recordOperation journals an operation that was just performed on duplicate. Failing to journal
+// does not undo the operation so the failure is only logged.
+func recordOperation(journal *Journal, operation Action, duplicate, original FileHash, destination string) {
+	err := journal.Record(JournalEntry{
+		Time:        time.Now(),
+		Operation:   operation,
+		Path:        duplicate.AbsolutePath,
+		Original:    original.AbsolutePath,
+		Hash:        duplicate.Hash,
+		Algorithm:   duplicate.Algorithm,
+		Destination: destination,
+	})
+	if err != nil {
+		log.Printf("unable to journal %s of %q: %v", operation, duplicate.AbsolutePath, err)
+	}
+}
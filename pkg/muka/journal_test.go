@@ -0,0 +1,194 @@
+package muka
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournalUndoRestoresDuplicates(t *testing.T) {
+	actions := []Action{ActionHardLink, ActionSymlink, ActionTrash, ActionQuarantine}
+
+	for _, action := range actions {
+		dir, original, duplicate := makeDuplicates(t)
+		defer os.RemoveAll(dir)
+
+		defer os.Setenv("XDG_DATA_HOME", os.Getenv("XDG_DATA_HOME"))
+		os.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+
+		journal := NewJournal(filepath.Join(dir, "journal.jsonl"))
+		deleter, err := NewDeleter(DeleterOptions{
+			Action:        action,
+			QuarantineDir: filepath.Join(dir, "quarantine"),
+			Roots:         []string{dir},
+			Journal:       journal,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := deleter.Delete(duplicate, original); err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := journal.Undo(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertEqualsI(t, 1, len(result.Undone))
+		assertEqualsI(t, 0, len(result.Failed))
+
+		info, err := os.Lstat(duplicate.AbsolutePath)
+		if err != nil {
+			t.Fatalf("%s: %v", action, err)
+		}
+
+		originalInfo, err := os.Stat(original.AbsolutePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !info.Mode().IsRegular() || os.SameFile(info, originalInfo) {
+			t.Errorf("%s: the duplicate should be an independent copy again", action)
+		}
+
+		contents, err := ioutil.ReadFile(duplicate.AbsolutePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(contents) != "contents" {
+			t.Errorf("%s: unexpected contents %q", action, contents)
+		}
+
+		entries, err := journal.Entries()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEqualsI(t, 0, len(entries))
+	}
+}
+
+func TestJournalUndoKeepsIrreversibleEntries(t *testing.T) {
+	dir, original, duplicate := makeDuplicates(t)
+	defer os.RemoveAll(dir)
+
+	journal := NewJournal(filepath.Join(dir, "journal.jsonl"))
+	deleter, err := NewDeleter(DeleterOptions{Action: ActionDelete, Journal: journal})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := deleter.Delete(duplicate, original); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := journal.Undo(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqualsI(t, 0, len(result.Undone))
+	assertEqualsI(t, 1, len(result.Irreversible))
+
+	entries, err := journal.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqualsI(t, 1, len(entries))
+}
+
+func TestJournalUndoOnlyUndoesTheLatestRuns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMuka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "journal.jsonl")
+	quarantineDir := filepath.Join(dir, "quarantine")
+
+	// every run quarantines a file of its own and the last one only deletes
+	var duplicates []string
+	for i := 0; i < 3; i++ {
+		original := filepath.Join(dir, fmt.Sprintf("original%d.txt", i))
+		duplicate := filepath.Join(dir, fmt.Sprintf("duplicate%d.txt", i))
+		for _, name := range []string{original, duplicate} {
+			if err := ioutil.WriteFile(name, []byte("contents"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		duplicates = append(duplicates, duplicate)
+
+		journal := NewJournal(path)
+		journal.run = fmt.Sprintf("run%d", i)
+		deleter, err := NewDeleter(DeleterOptions{
+			Action:        ActionQuarantine,
+			QuarantineDir: quarantineDir,
+			Roots:         []string{dir},
+			Journal:       journal,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := deleter.Delete(fileHashOf(duplicate), fileHashOf(original)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deletions := NewJournal(path)
+	deletions.run = "deletions"
+	if err := deletions.Record(JournalEntry{Operation: ActionDelete, Path: filepath.Join(dir, "deleted.txt")}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := NewJournal(path).Undo(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the deletions that came after the latest run are listed along the way
+	assertEqualsI(t, 1, len(result.Undone))
+	assertEqualsI(t, 1, len(result.Irreversible))
+	if !FileExists(duplicates[2]) || FileExists(duplicates[1]) || FileExists(duplicates[0]) {
+		t.Error("only the file of the latest run with something to restore should be restored")
+	}
+
+	result, err = NewJournal(path).Undo(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqualsI(t, 2, len(result.Undone))
+	assertEqualsI(t, 1, len(result.Irreversible))
+	for _, duplicate := range duplicates {
+		if !FileExists(duplicate) {
+			t.Errorf("%q should have been restored", duplicate)
+		}
+	}
+}
+
+func TestDryRunIsNotJournaled(t *testing.T) {
+	dir, original, duplicate := makeDuplicates(t)
+	defer os.RemoveAll(dir)
+
+	journal := NewJournal(filepath.Join(dir, "journal.jsonl"))
+	deleter, err := NewDeleter(DeleterOptions{Action: ActionDelete, IsDryRun: true, Journal: journal})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := deleter.Delete(duplicate, original); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := journal.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqualsI(t, 0, len(entries))
+}
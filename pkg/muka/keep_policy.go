@@ -0,0 +1,155 @@
+package muka
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KeepPolicy decides which file of a group of duplicates is kept as the original
+type KeepPolicy string
+
+const (
+	// KeepOldest keeps the file modified the longest time ago
+	KeepOldest KeepPolicy = "oldest"
+	// KeepNewest keeps the most recently modified file
+	KeepNewest KeepPolicy = "newest"
+	// KeepShortestPath keeps the file with the shortest absolute path
+	KeepShortestPath KeepPolicy = "shortest-path"
+	// KeepLongestPath keeps the file with the longest absolute path
+	KeepLongestPath KeepPolicy = "longest-path"
+	// KeepFirstRoot keeps the file found under the root directory given first
+	KeepFirstRoot KeepPolicy = "first-root"
+	// KeepMostLinks keeps the file with the most hard links
+	KeepMostLinks KeepPolicy = "most-links"
+)
+
+// KeepPolicies lists every supported KeepPolicy
+var KeepPolicies = []KeepPolicy{KeepOldest, KeepNewest, KeepShortestPath, KeepLongestPath, KeepFirstRoot, KeepMostLinks}
+
+// ParseKeepPolicies parses a comma separated list of policies. Later policies break the ties of earlier ones.
+// If the input is empty, an empty list is returned with no errors.
+func ParseKeepPolicies(s string) ([]KeepPolicy, error) {
+
+	var policies []KeepPolicy
+	if len(s) == 0 {
+		return policies, nil
+	}
+
+	for _, token := range strings.Split(s, ",") {
+		policy := KeepPolicy(strings.TrimSpace(token))
+		if _, err := policy.comparator(); err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+
+	return policies, nil
+}
+
+// comparator returns a function that is negative when a is preferred over b, positive when b is preferred
+// over a and zero when the policy has no preference
+func (policy KeepPolicy) comparator() (func(a, b FileHash) int, error) {
+
+	compareInts := func(a, b int64) int {
+		if a < b {
+			return -1
+		}
+		if a > b {
+			return 1
+		}
+		return 0
+	}
+
+	switch policy {
+	case KeepOldest:
+		return func(a, b FileHash) int {
+			return compareInts(a.ModTime.UnixNano(), b.ModTime.UnixNano())
+		}, nil
+	case KeepNewest:
+		return func(a, b FileHash) int {
+			return compareInts(b.ModTime.UnixNano(), a.ModTime.UnixNano())
+		}, nil
+	case KeepShortestPath:
+		return func(a, b FileHash) int {
+			return compareInts(int64(len(a.AbsolutePath)), int64(len(b.AbsolutePath)))
+		}, nil
+	case KeepLongestPath:
+		return func(a, b FileHash) int {
+			return compareInts(int64(len(b.AbsolutePath)), int64(len(a.AbsolutePath)))
+		}, nil
+	case KeepFirstRoot:
+		return func(a, b FileHash) int {
+			return compareInts(int64(a.RootIndex), int64(b.RootIndex))
+		}, nil
+	case KeepMostLinks:
+		return func(a, b FileHash) int {
+			return compareInts(int64(b.Links), int64(a.Links))
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown keep policy %q", policy)
+	}
+}
+
+// compareBools prefers the file for which the flag is set
+func compareBools(a, b bool) int {
+	if a == b {
+		return 0
+	}
+	if a {
+		return -1
+	}
+	return 1
+}
+
+// selectOriginal makes the file preferred by the policies the original of the group. Reference files, then
+// files under preferred and then protected directories always come first. Files the policies do not tell
+// apart keep the order they were found in.
+func selectOriginal(dup DuplicateFile, policies []KeepPolicy) DuplicateFile {
+
+	comparators := []func(a, b FileHash) int{
+		func(a, b FileHash) int {
+			return compareBools(a.IsReference, b.IsReference)
+		},
+		func(a, b FileHash) int {
+			return compareBools(a.IsPreferred, b.IsPreferred)
+		},
+		func(a, b FileHash) int {
+			return compareBools(a.IsProtected, b.IsProtected)
+		},
+	}
+	for _, policy := range policies {
+		// policies are validated by ParseKeepPolicies so unknown ones are simply ignored here
+		if comparator, err := policy.comparator(); err == nil {
+			comparators = append(comparators, comparator)
+		}
+	}
+
+	prefers := func(a, b FileHash) bool {
+		for _, comparator := range comparators {
+			if c := comparator(a, b); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	}
+
+	files := append([]FileHash{dup.Original}, dup.Duplicates...)
+	best := 0
+	for i := 1; i < len(files); i++ {
+		if prefers(files[i], files[best]) {
+			best = i
+		}
+	}
+
+	selected := DuplicateFile{
+		Original:   files[best],
+		Duplicates: make([]FileHash, 0, len(files)-1),
+	}
+	for i, f := range files {
+		if i != best {
+			selected.Duplicates = append(selected.Duplicates, f)
+		}
+	}
+
+	return selected
+}
@@ -0,0 +1,74 @@
+package muka
+
+import (
+	"testing"
+	"time"
+)
+
+func keepPolicyHashes() []FileHash {
+	now := time.Now()
+
+	return []FileHash{
+		{
+			FileData: FileData{
+				AbsolutePath: "/tmp/copy/file.txt",
+				ModTime:      now,
+				Links:        1,
+			},
+			Hash: "abcdefg",
+		},
+		{
+			FileData: FileData{
+				AbsolutePath: "/archive/file.txt",
+				ModTime:      now.Add(-time.Hour),
+				Links:        1,
+				RootIndex:    1,
+			},
+			Hash: "abcdefg",
+		},
+		{
+			FileData: FileData{
+				AbsolutePath: "/archive/2021/file.txt",
+				ModTime:      now.Add(-time.Hour),
+				Links:        2,
+				RootIndex:    1,
+			},
+			Hash: "abcdefg",
+		},
+	}
+}
+
+func TestKeepPoliciesChooseOriginal(t *testing.T) {
+	expectedOriginals := map[string]string{
+		"":                     "/tmp/copy/file.txt",
+		"oldest":               "/archive/file.txt",
+		"newest":               "/tmp/copy/file.txt",
+		"shortest-path":        "/archive/file.txt",
+		"longest-path":         "/archive/2021/file.txt",
+		"first-root":           "/tmp/copy/file.txt",
+		"most-links":           "/archive/2021/file.txt",
+		"oldest,longest-path":  "/archive/2021/file.txt",
+		"oldest,shortest-path": "/archive/file.txt",
+	}
+
+	for input, expected := range expectedOriginals {
+		policies, err := ParseKeepPolicies(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		duplicates := FindDuplicateFiles(Directory{HashedFiles: keepPolicyHashes()}, policies...)
+		assertEqualsI(t, 1, len(duplicates))
+		assertEqualsI(t, 2, len(duplicates[0].Duplicates))
+
+		if duplicates[0].Original.AbsolutePath != expected {
+			t.Errorf("%q: expected %q to be kept but got %q", input, expected, duplicates[0].Original.AbsolutePath)
+		}
+	}
+}
+
+func TestParseUnknownKeepPolicy(t *testing.T) {
+	if _, err := ParseKeepPolicies("oldest,biggest"); err == nil {
+		t.Error("an unknown policy should be rejected")
+	}
+}
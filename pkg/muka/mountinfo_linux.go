@@ -0,0 +1,62 @@
+//go:build linux
+// +build linux
+
+package muka
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// mountInfoPath lists the filesystems mounted in the namespace of the process
+const mountInfoPath = "/proc/self/mountinfo"
+
+// filesystemTypes returns the type of every mounted filesystem keyed by its device number
+func filesystemTypes() (map[uint64]string, error) {
+	f, err := os.Open(mountInfoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseMountInfo(f)
+}
+
+// parseMountInfo reads the filesystem types out of the mountinfo format described in proc(5):
+//
+//	36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+func parseMountInfo(r io.Reader) (map[uint64]string, error) {
+	types := make(map[uint64]string)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+
+		var major, minor uint64
+		if _, err := fmt.Sscanf(fields[2], "%d:%d", &major, &minor); err != nil {
+			return nil, fmt.Errorf("malformed mountinfo line %q: %v", scanner.Text(), err)
+		}
+
+		// the optional fields end with a lone hyphen followed by the filesystem type
+		for i := 3; i < len(fields)-1; i++ {
+			if fields[i] == "-" {
+				types[makeDevice(major, minor)] = fields[i+1]
+				break
+			}
+		}
+	}
+
+	return types, scanner.Err()
+}
+
+// makeDevice encodes major and minor device numbers the way the st_dev field of stat(2) does
+func makeDevice(major, minor uint64) uint64 {
+
+	return (major&0x00000fff)<<8 | (major&0xfffff000)<<32 | minor&0x000000ff | (minor&0xffffff00)<<12
+}
@@ -0,0 +1,63 @@
+//go:build linux
+// +build linux
+
+package muka
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseMountInfo(t *testing.T) {
+	mountInfo := strings.Join([]string{
+		"23 28 0:22 / /proc rw,relatime - proc proc rw",
+		"36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue",
+		"40 28 259:1048577 / /data rw shared:7 master:2 - nfs server:/export rw",
+	}, "\n")
+
+	types, err := parseMountInfo(strings.NewReader(mountInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[uint64]string{
+		22:                 "proc",
+		98 << 8:            "ext3",
+		259<<8 | 1<<32 | 1: "nfs",
+	}
+	assertEqualsI(t, len(expected), len(types))
+	for device, fsType := range expected {
+		if types[device] != fsType {
+			t.Errorf("expected device %d to be %q but got %q", device, fsType, types[device])
+		}
+	}
+}
+
+func TestExcludeFilesystemTypes(t *testing.T) {
+	dir := makeLibrary(t)
+	defer os.RemoveAll(dir)
+
+	types, err := filesystemTypes()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	device, _, _ := fileIdentity(mustStat(t, dir))
+	fsType, known := types[device]
+	if !known {
+		t.Skipf("the filesystem of %q is not in %s", dir, mountInfoPath)
+	}
+
+	d, err := CollectFiles(FileCollectionOptions{DirectoryToSearch: dir, ExcludeFilesystemTypes: []string{fsType}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqualsI(t, 0, len(d.EncounteredFiles))
+
+	d, err = CollectFiles(FileCollectionOptions{DirectoryToSearch: dir, ExcludeFilesystemTypes: []string{"not-" + fsType}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqualsI(t, 2, len(d.EncounteredFiles))
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package muka
+
+import (
+	"errors"
+)
+
+// filesystemTypes returns the type of every mounted filesystem keyed by its device number
+func filesystemTypes() (map[uint64]string, error) {
+
+	return nil, errors.New("filesystem types are only available on linux")
+}
@@ -2,7 +2,6 @@ package muka
 
 import (
 	"bufio"
-	"crypto/sha1"
 	"encoding/hex"
 	"fmt"
 	"io"
@@ -10,7 +9,10 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/fatih/color"
 )
@@ -22,12 +24,43 @@ type FileSizeCache map[int64]int
 type FileData struct {
 	AbsolutePath string
 	SizeInBytes  int64
+	ModTime      time.Time
+	// Device and Inode identify the file on disk. Both are zero on platforms
+	// that do not expose them.
+	Device uint64
+	Inode  uint64
+	// Links is the number of hard links to the file
+	Links uint64
+	// RootIndex is the position of the searched root directory the file was found under
+	RootIndex int
+	// IsReference is set for files found under FileCollectionOptions.ReferenceDirectories.
+	// Reference files are only ever used as originals.
+	IsReference bool
+	// IsPreferred is set for files under FileCollectionOptions.PreferredDirectories
+	IsPreferred bool
+	// IsProtected is set for files under FileCollectionOptions.ProtectedDirectories
+	IsProtected bool
+	// HardLinks are the other paths found to the same file. They are not reported as duplicates
+	// of AbsolutePath and are acted upon along with it.
+	HardLinks []string
+}
+
+// ReclaimableBytes returns the space freed by removing the file along with its hard links.
+// Nothing is freed while links to the file outside of the search remain.
+func (data FileData) ReclaimableBytes() int64 {
+	if data.Links > uint64(1+len(data.HardLinks)) {
+		return 0
+	}
+
+	return data.SizeInBytes
 }
 
 // FileHash defines the file hash
 type FileHash struct {
 	FileData
 	Hash string
+	// Algorithm is the name of the Hasher that produced Hash
+	Algorithm string
 }
 
 func (hash FileHash) String() string {
@@ -35,10 +68,32 @@ func (hash FileHash) String() string {
 	return hash.AbsolutePath
 }
 
+// links returns the file hash followed by one file hash for each of its hard links
+func (hash FileHash) links() []FileHash {
+	links := []FileHash{hash}
+	for _, path := range hash.HardLinks {
+		link := hash
+		link.AbsolutePath = path
+		link.HardLinks = nil
+		links = append(links, link)
+	}
+
+	return links
+}
+
 // Directory holds the collected information about a directory
 type Directory struct {
 	EncounteredFiles []FileData
 	HashedFiles      []FileHash
+	Stats            HashStats
+	// SkippedSymlinks are the symbolic links that were neither collected nor descended into
+	SkippedSymlinks []SkippedSymlink
+}
+
+// HashStats records how many bytes each stage of the hashing pipeline avoided reading
+type HashStats struct {
+	SizeStageSkippedBytes    int64
+	PartialStageSkippedBytes int64
 }
 
 // DuplicateFile holds original and duplicate FileHashes
@@ -54,9 +109,18 @@ func (duplicate DuplicateFile) String() string {
 
 	var b strings.Builder
 
+	// hard links are the same file so they are listed next to it rather than as duplicates
+	hardLinks := func(hash FileHash) {
+		if len(hash.HardLinks) > 0 {
+			fmt.Fprintf(&b, " (hard links: %s)", strings.Join(hash.HardLinks, ", "))
+		}
+	}
+
 	bold.Fprint(&b, "Original: ")
 
-	green.Fprintf(&b, "%s\n", duplicate.Original)
+	green.Fprint(&b, duplicate.Original)
+	hardLinks(duplicate.Original)
+	fmt.Fprintln(&b)
 	dupLength := len(duplicate.Duplicates)
 	if dupLength == 0 {
 		return b.String()
@@ -65,10 +129,12 @@ func (duplicate DuplicateFile) String() string {
 	bold.Fprint(&b, "Duplicates: [ ")
 	for i := 0; i < dupLength-1; i++ {
 		red.Fprint(&b, duplicate.Duplicates[i].String())
+		hardLinks(duplicate.Duplicates[i])
 		bold.Fprint(&b, ", ")
 	}
 
 	red.Fprint(&b, duplicate.Duplicates[dupLength-1].String())
+	hardLinks(duplicate.Duplicates[dupLength-1])
 	bold.Fprint(&b, " ]\n")
 
 	return b.String()
@@ -77,19 +143,81 @@ func (duplicate DuplicateFile) String() string {
 // FileCollectionOptions options used by CollectFiles
 type FileCollectionOptions struct {
 	DirectoryToSearch string
-	ExcludeDirs       []*regexp.Regexp
-	ExcludeFiles      []*regexp.Regexp
+	// DirectoriesToSearch are searched after DirectoryToSearch
+	DirectoriesToSearch []string
+	// ReferenceDirectories are searched last. Their files are only ever used as originals
+	// and are never candidates for deletion.
+	ReferenceDirectories []string
+	ExcludeDirs          []*regexp.Regexp
+	ExcludeFiles         []*regexp.Regexp
+	// IncludePatterns, when not empty, are doublestar glob patterns selecting the files to collect.
+	// ExcludePatterns prune the directories and files they match. Both are matched against the slash
+	// separated path relative to the root, like vendor/**/testdata.
+	IncludePatterns []string
+	ExcludePatterns []string
+	// Parallelism is the number of files hashed concurrently.
+	// A value less than 1 defaults to DefaultParallelism().
+	Parallelism int
+	// PartialHashBytes is the number of bytes read from both the start and the end
+	// of a file to rule it out before fully hashing it.
+	// A value less than 1 defaults to DefaultPartialHashBytes.
+	PartialHashBytes int64
+	// Hasher is the algorithm used to hash files. Defaults to DefaultHasher() when nil.
+	Hasher Hasher
+	// HashCache, when not nil, is consulted before hashing a file and updated with every new hash
+	HashCache *HashCache
+	// PreferredDirectories are where originals are chosen from whenever possible
+	PreferredDirectories []string
+	// ProtectedDirectories hold files that must never be acted upon. They are preferred as originals
+	// right after PreferredDirectories.
+	ProtectedDirectories []string
+	// MaxDepth, when greater than 0, is the deepest level below a root that is searched.
+	// Files directly inside a root are at depth 1, like with find's -maxdepth.
+	MaxDepth int
+	// MinDepth, when greater than 0, is the shallowest level below a root that files are collected from
+	MinDepth int
+	// FollowSymlinks descends into linked directories and collects linked files under their real path.
+	// Otherwise symbolic links are skipped and reported in Directory.SkippedSymlinks.
+	FollowSymlinks bool
+	// OneFileSystem skips directories and files on another filesystem than the root they are found under
+	OneFileSystem bool
+	// ExcludeFilesystemTypes skips directories and files on filesystems of these types, like nfs or tmpfs.
+	// Filesystem types are only known on linux.
+	ExcludeFilesystemTypes []string
+	// NoIgnore collects files regardless of the patterns in the IgnoreFileNames files found while searching
+	NoIgnore bool
+	// MinSize and, when greater than 0, MaxSize bound the size in bytes of the files collected
+	MinSize int64
+	MaxSize int64
+	// NewerThan and OlderThan, when not zero, bound the modification time of the files collected
+	NewerThan time.Time
+	OlderThan time.Time
+	// Type selects the kinds of files collected. An empty Type is FileTypeRegular.
+	Type FileType
+}
+
+// DefaultPartialHashBytes is the default number of bytes read from each end of a file by the partial hash
+const DefaultPartialHashBytes = 4096
+
+// DefaultParallelism returns the default number of files hashed concurrently
+func DefaultParallelism() int {
+
+	return runtime.GOMAXPROCS(0)
 }
 
 // Report reports on program performance
 type Report struct {
-	CollectedFileCount    int
-	CollectedFileSizeInKB float64
-	DuplicateFileCount    int
-	DuplicateFileSizeInKB float64
-	DuplicatePercentage   float64
-	DeletedFileCount      int
-	DeletedFileSizeInKB   float64
+	CollectedFileCount    int     `json:"collected_file_count"`
+	CollectedFileSizeInKB float64 `json:"collected_file_size_kb"`
+	DuplicateFileCount    int     `json:"duplicate_file_count"`
+	DuplicateFileSizeInKB float64 `json:"duplicate_file_size_kb"`
+	DuplicatePercentage   float64 `json:"duplicate_percentage"`
+	DeletedFileCount      int     `json:"deleted_file_count"`
+	DeletedFileSizeInKB   float64 `json:"deleted_file_size_kb"`
+	// SizeStageSkippedKB is the amount of data not read because the file size was unique
+	SizeStageSkippedKB float64 `json:"size_stage_skipped_kb"`
+	// PartialStageSkippedKB is the amount of data not read because the partial hash was unique
+	PartialStageSkippedKB float64 `json:"partial_stage_skipped_kb"`
 }
 
 func (r Report) String() string {
@@ -120,105 +248,457 @@ func (r Report) String() string {
 	delUnit, delSize := unitSizeFn(r.DeletedFileSizeInKB)
 	bold.Fprintf(&b, "%d files were deleted saving %.2f %s\n", r.DeletedFileCount, delSize, delUnit)
 
+	sizeUnit, sizeSkipped := unitSizeFn(r.SizeStageSkippedKB)
+	partialUnit, partialSkipped := unitSizeFn(r.PartialStageSkippedKB)
+	bold.Fprintf(&b, "Reads Avoided: %.2f %s by size, %.2f %s by partial hash\n",
+		sizeSkipped, sizeUnit, partialSkipped, partialUnit)
+
 	return b.String()
 }
 
-// CollectFiles Recursively walks the provided directory and processes each file and directory it encounters
+// collectedPath locates a path collected by CollectFiles: either the path of fileData[file] or,
+// when link is not negative, one of its hard links
+type collectedPath struct {
+	file int
+	link int
+}
+
+// set replaces the path collectedPath locates
+func (c collectedPath) set(fileData []FileData, path string) {
+	if c.link < 0 {
+		fileData[c.file].AbsolutePath = path
+	} else {
+		fileData[c.file].HardLinks[c.link] = path
+	}
+}
+
+// CollectFiles Recursively walks the provided directories and processes each file and directory it encounters
 // This function will return, in order, a list of all the files it encountered, a list of files that were hashed,
 // and an error if one is encountered.
+// Files are only collected once even when roots overlap, are nested within each other or are reached through symbolic links.
 func CollectFiles(options FileCollectionOptions) (Directory, error) {
+	preferred, err := resolveDirs(options.PreferredDirectories)
+	if err != nil {
+		return Directory{}, err
+	}
+
+	protected, err := resolveDirs(options.ProtectedDirectories)
+	if err != nil {
+		return Directory{}, err
+	}
+
+	roots, references, err := options.roots()
+	if err != nil {
+		return Directory{}, err
+	}
+
+	// realRoots are the roots with their symbolic links resolved, in the same order, so the real paths
+	// of files reached through links can be placed under them
+	realRoots, err := resolveDirs(roots)
+	if err != nil {
+		return Directory{}, err
+	}
+
 	var fileData []FileData
 	sizeCache := make(FileSizeCache)
-	err := filepath.Walk(filepath.Clean(options.DirectoryToSearch), func(file string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	// seen maps the real path of every file collected to where it was recorded
+	seen := make(map[string]collectedPath)
+	// inodes maps the identity of every file collected to its position in fileData
+	inodes := make(map[[2]uint64]int)
+	w, err := newWalker(options)
+	if err != nil {
+		return Directory{}, err
+	}
 
-		if info.IsDir() {
-			for _, excludeDirPattern := range options.ExcludeDirs {
-				if excludeDirPattern.MatchString(info.Name()) {
-					return filepath.SkipDir
-				}
+	// every root is walked, even when nested in another, since the walk of the outer root may have pruned it.
+	// The seen check keeps files from being collected twice.
+	for _, root := range roots {
+		err := w.walk(root, func(file, realPath string, info os.FileInfo, depth int) error {
+			// files are acted upon where they were found but are only collected once, by their real path
+			foundPath, err := filepath.Abs(file)
+			if err != nil {
+				return err
 			}
-			return nil
-		}
 
-		for _, excludeFilePattern := range options.ExcludeFiles {
-			if excludeFilePattern.MatchString(info.Name()) {
+			absolutePath, err := filepath.Abs(realPath)
+			if err != nil {
+				return err
+			}
+
+			if collected, exists := seen[absolutePath]; exists {
+				// a file first reached through a symbolic link is known by its real path once the walk gets there
+				if foundPath == absolutePath {
+					collected.set(fileData, foundPath)
+				}
 				return nil
 			}
-		}
 
-		absolutePath, err := filepath.Abs(file)
-		if err != nil {
-			return err
-		}
+			// a file belongs to the root its real path is in, but a link from a reference root
+			// keeps what it leads to from ever being removed as well
+			linkRootIndex := deepestRoot(foundPath, roots)
+			realRootIndex := deepestRoot(absolutePath, realRoots)
+			if realRootIndex < 0 {
+				realRootIndex = deepestRoot(absolutePath, roots)
+			}
+			rootIndex := realRootIndex
+			if rootIndex < 0 {
+				rootIndex = linkRootIndex
+			}
+			// files that only live outside of every root, reached through links, are never acted upon
+			isReference := realRootIndex < 0 || references[realRootIndex] || references[linkRootIndex]
+			_, isPreferred := underAny(absolutePath, preferred)
+			_, isProtected := underAny(absolutePath, protected)
+			if _, isFoundProtected := underAny(foundPath, protected); isFoundProtected {
+				isProtected = true
+			}
 
-		if n, exists := sizeCache[info.Size()]; exists {
-			sizeCache[info.Size()] = n + 1
-		} else {
-			sizeCache[info.Size()] = 1
-		}
+			// hard links are one file on disk so they are only collected, and hashed, once
+			device, inode, ok := fileIdentity(info)
+			if ok {
+				if i, linked := inodes[[2]uint64{device, inode}]; linked {
+					linkedFile := &fileData[i]
+					seen[absolutePath] = collectedPath{file: i, link: len(linkedFile.HardLinks)}
+					linkedFile.HardLinks = append(linkedFile.HardLinks, foundPath)
+					linkedFile.IsReference = linkedFile.IsReference || isReference
+					linkedFile.IsPreferred = linkedFile.IsPreferred || isPreferred
+					linkedFile.IsProtected = linkedFile.IsProtected || isProtected
+					return nil
+				}
+				inodes[[2]uint64{device, inode}] = len(fileData)
+			}
+			seen[absolutePath] = collectedPath{file: len(fileData), link: -1}
 
-		fileData = append(fileData, FileData{
-			AbsolutePath: absolutePath,
-			SizeInBytes:  info.Size(),
-		})
+			if n, exists := sizeCache[info.Size()]; exists {
+				sizeCache[info.Size()] = n + 1
+			} else {
+				sizeCache[info.Size()] = 1
+			}
 
-		return nil
-	})
+			// the file belongs to the most specific root containing it
+			fileData = append(fileData, FileData{
+				AbsolutePath: foundPath,
+				SizeInBytes:  info.Size(),
+				ModTime:      info.ModTime(),
+				Device:       device,
+				Inode:        inode,
+				Links:        linkCount(info),
+				RootIndex:    rootIndex,
+				IsReference:  isReference,
+				IsPreferred:  isPreferred,
+				IsProtected:  isProtected,
+			})
 
-	if err != nil {
-		return Directory{}, err
+			return nil
+		})
+
+		if err != nil {
+			return Directory{}, err
+		}
 	}
 
+	hashedFiles, stats := hashFiles(fileData, sizeCache, options)
+
 	return Directory{
 		EncounteredFiles: fileData,
-		HashedFiles:      hashFiles(fileData, sizeCache),
+		HashedFiles:      hashedFiles,
+		Stats:            stats,
+		SkippedSymlinks:  w.skipped,
 	}, nil
 }
 
-func hashFiles(fileData []FileData, sizeCache FileSizeCache) []FileHash {
+// roots returns the absolute path of every directory to walk in order: DirectoryToSearch, DirectoriesToSearch
+// and then ReferenceDirectories. The second return value tells which of them are reference directories.
+func (options FileCollectionOptions) roots() ([]string, map[int]bool, error) {
+	var dirs []string
+	if options.DirectoryToSearch != "" {
+		dirs = append(dirs, options.DirectoryToSearch)
+	}
+	dirs = append(dirs, options.DirectoriesToSearch...)
+	searchCount := len(dirs)
+	dirs = append(dirs, options.ReferenceDirectories...)
+
+	roots, err := AbsolutePaths(dirs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	references := make(map[int]bool)
+	for i := searchCount; i < len(roots); i++ {
+		references[i] = true
+	}
+
+	return roots, references, nil
+}
+
+// hashFiles runs the files through a multi-stage pipeline and fully hashes only the
+// files that could still be duplicates after each stage:
+//  1. files with a unique size are dropped
+//  2. files whose first and last partialHashBytes bytes are unique are dropped
+//  3. the remaining files are hashed end to end
+//
+// Each stage uses a pool of parallelism workers. The returned hashes are in the
+// same order as fileData regardless of the number of workers.
+func hashFiles(fileData []FileData, sizeCache FileSizeCache, options FileCollectionOptions) ([]FileHash, HashStats) {
+
+	parallelism := options.Parallelism
+	if parallelism < 1 {
+		parallelism = DefaultParallelism()
+	}
+
+	partialHashBytes := options.PartialHashBytes
+	if partialHashBytes < 1 {
+		partialHashBytes = DefaultPartialHashBytes
+	}
 
-	fileHashes := make([]FileHash, 0, len(fileData))
+	hasher := options.Hasher
+	if hasher == nil {
+		hasher = DefaultHasher()
+	}
+
+	var stats HashStats
+
+	// If the file has a unique size, there is no way it could be a duplicate
+	// so we avoid having to hash it for performance reasons
+	candidates := make([]FileData, 0, len(fileData))
 	for _, fd := range fileData {
-		// If the file has a unique size, there is no way it could be a duplicate
-		// so we avoid having to hash it for performance reasons
 		if sizeCache[fd.SizeInBytes] > 1 {
-			h, err := hashFile(fd.AbsolutePath)
-			if err == nil {
-				fileHashes = append(fileHashes, FileHash{
-					FileData: fd,
-					Hash:     h,
-				})
-			} else {
-				log.Printf("hashing %q : %v", fd.AbsolutePath, err)
+			candidates = append(candidates, fd)
+		} else {
+			stats.SizeStageSkippedBytes += fd.SizeInBytes
+		}
+	}
+
+	// Files with a cached hash need not be read at all. Their sizes are remembered
+	// so that no file of the same size is ruled out by the partial hash alone.
+	cachedHashes := make([]string, len(candidates))
+	cachedSizes := make(map[int64]bool)
+	if options.HashCache != nil {
+		for i, fd := range candidates {
+			if h, exists := options.HashCache.Lookup(fd, hasher.Name()); exists {
+				cachedHashes[i] = h
+				cachedSizes[fd.SizeInBytes] = true
+			}
+		}
+	}
+
+	// Files no larger than both ends would be read in full by the partial hash
+	// so they skip straight to the full hash
+	needsPartialHash := func(i int) bool {
+		return cachedHashes[i] == "" && candidates[i].SizeInBytes > 2*partialHashBytes
+	}
+
+	// the partial hashes of files ruled out by them in earlier runs are cached too
+	partialHashes := make([]string, len(candidates))
+	cachedPartialHashes := make([]bool, len(candidates))
+	if options.HashCache != nil {
+		for i, fd := range candidates {
+			if needsPartialHash(i) {
+				partialHashes[i], cachedPartialHashes[i] = options.HashCache.LookupPartial(fd, hasher.Name(), partialHashBytes)
+			}
+		}
+	}
+
+	errs := make([]error, len(candidates))
+	forEachParallel(len(candidates), parallelism, func(i int) {
+		if needsPartialHash(i) && !cachedPartialHashes[i] {
+			partialHashes[i], errs[i] = hashFileEnds(hasher, candidates[i], partialHashBytes)
+		}
+	})
+
+	if options.HashCache != nil {
+		for i, fd := range candidates {
+			if needsPartialHash(i) && !cachedPartialHashes[i] && errs[i] == nil {
+				options.HashCache.StorePartial(fd, hasher.Name(), partialHashBytes, partialHashes[i])
 			}
 		}
 	}
 
-	return fileHashes
+	type partialKey struct {
+		size int64
+		hash string
+	}
+
+	partialCounts := make(map[partialKey]int)
+	for i, fd := range candidates {
+		if errs[i] == nil && cachedHashes[i] == "" {
+			partialCounts[partialKey{fd.SizeInBytes, partialHashes[i]}]++
+		}
+	}
+
+	remaining := make([]FileData, 0, len(candidates))
+	hashes := make([]string, 0, len(candidates))
+	for i, fd := range candidates {
+		if errs[i] != nil {
+			log.Printf("hashing %q : %v", fd.AbsolutePath, errs[i])
+			continue
+		}
+		if cachedHashes[i] != "" || cachedSizes[fd.SizeInBytes] || partialCounts[partialKey{fd.SizeInBytes, partialHashes[i]}] > 1 {
+			remaining = append(remaining, fd)
+			hashes = append(hashes, cachedHashes[i])
+		} else {
+			stats.PartialStageSkippedBytes += fd.SizeInBytes - 2*partialHashBytes
+		}
+	}
+
+	errs = make([]error, len(remaining))
+	forEachParallel(len(remaining), parallelism, func(i int) {
+		if hashes[i] == "" {
+			hashes[i], errs[i] = hashFile(hasher, remaining[i].AbsolutePath)
+		}
+	})
+
+	fileHashes := make([]FileHash, 0, len(remaining))
+	for i, fd := range remaining {
+		if errs[i] != nil {
+			log.Printf("hashing %q : %v", fd.AbsolutePath, errs[i])
+			continue
+		}
+		fileHash := FileHash{
+			FileData:  fd,
+			Hash:      hashes[i],
+			Algorithm: hasher.Name(),
+		}
+		if options.HashCache != nil {
+			options.HashCache.Store(fileHash)
+		}
+		fileHashes = append(fileHashes, fileHash)
+	}
+
+	return fileHashes, stats
+}
+
+// forEachParallel calls fn for every index in [0, n) using a pool of parallelism workers.
+// Each index is handed to exactly one worker so fn may write to the slot of its index
+// without further synchronization.
+func forEachParallel(n int, parallelism int, fn func(i int)) {
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
 }
 
-func hashFile(filePath string) (string, error) {
+// hashFileEnds hashes the first and last n bytes of the file
+func hashFileEnds(hasher Hasher, fd FileData, n int64) (string, error) {
+	file, err := os.Open(fd.AbsolutePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := hasher.New()
+	if _, err := io.CopyN(h, file, n); err != nil {
+		return "", err
+	}
+
+	if _, err := file.Seek(fd.SizeInBytes-n, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	if _, err := io.CopyN(h, file, n); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum([]byte{})), nil
+}
+
+func hashFile(hasher Hasher, filePath string) (string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return "", err
 	}
 	defer file.Close()
 
-	hasher := sha1.New()
-	if _, err := io.Copy(hasher, file); err != nil {
+	h := hasher.New()
+	if _, err := io.Copy(h, file); err != nil {
 		return "", err
 	}
 
-	return hex.EncodeToString(hasher.Sum([]byte{})), nil
+	return hex.EncodeToString(h.Sum([]byte{})), nil
+}
+
+// checkUnchanged returns an error if the file no longer has the size, modification time and hash recorded in hash
+func checkUnchanged(hash FileHash) error {
+	info, err := os.Stat(hash.AbsolutePath)
+	if err != nil {
+		return err
+	}
+
+	if info.Size() != hash.SizeInBytes {
+		return fmt.Errorf("%q changed size from %d to %d bytes", hash.AbsolutePath, hash.SizeInBytes, info.Size())
+	}
+
+	if !info.ModTime().Equal(hash.ModTime) {
+		return fmt.Errorf("%q was modified at %v", hash.AbsolutePath, info.ModTime())
+	}
+
+	hasher, err := LookupHasher(hash.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	h, err := hashFile(hasher, hash.AbsolutePath)
+	if err != nil {
+		return err
+	}
+
+	if h != hash.Hash {
+		return fmt.Errorf("the contents of %q changed", hash.AbsolutePath)
+	}
+
+	return nil
 }
 
-// FindDuplicateFiles does as it suggests
-func FindDuplicateFiles(directory Directory) []DuplicateFile {
+// checkGroupUnchanged returns an error if the original or any of the duplicates changed since they were hashed
+func checkGroupUnchanged(dup DuplicateFile) error {
+	for _, f := range append([]FileHash{dup.Original}, dup.Duplicates...) {
+		for _, link := range f.links() {
+			if err := checkUnchanged(link); err != nil {
+				return err
+			}
+		}
+	}
 
-	cache := NewCache()
+	return nil
+}
+
+// deleteLinks hands the file and each of its hard links to deleter and reports whether all of them
+// were acted upon. Space is only reclaimed once every link to a file is gone. Protected and reference
+// files are never handed to deleter, whichever Deleter it is.
+func deleteLinks(deleter Deleter, file, original FileHash) bool {
+	if file.IsProtected || file.IsReference {
+		log.Printf("unable to delete %q: it is protected", file.AbsolutePath)
+		return false
+	}
+
+	deleted := true
+	for _, link := range file.links() {
+		if err := deleter.Delete(link, original); err != nil {
+			log.Printf("unable to delete %q: %v", link.AbsolutePath, err)
+			deleted = false
+		}
+	}
+
+	return deleted
+}
+
+// FindDuplicateFiles does as it suggests. The policies choose the original of each group of duplicates.
+func FindDuplicateFiles(directory Directory, policies ...KeepPolicy) []DuplicateFile {
+
+	cache := NewCache(policies...)
 	for _, fileHash := range directory.HashedFiles {
 		cache.Add(fileHash)
 	}
@@ -244,24 +724,33 @@ func PromptToDelete(writer io.Writer, reader io.Reader, deleter Deleter, dup Dup
 			continue
 		}
 
-		switch answer := line[0]; answer {
+		answer := line[0]
+		if answer == 'd' || answer == 'o' {
+			// the scan may be stale by the time the user answers
+			if err := checkGroupUnchanged(dup); err != nil {
+				log.Printf("skipping %q and its duplicates: %v", dup.Original.AbsolutePath, err)
+				return []FileHash{}, err
+			}
+		}
+
+		switch answer {
 		case 'd':
 			deletedFiles := make([]FileHash, 0, len(dup.Duplicates))
 			for _, d := range dup.Duplicates {
-				if err := deleter.Delete(d.AbsolutePath); err == nil {
+				if deleteLinks(deleter, d, dup.Original) {
 					deletedFiles = append(deletedFiles, d)
-				} else {
-					log.Printf("unable to delete %q: %v", d.AbsolutePath, err)
 				}
 			}
 			return deletedFiles, nil
 		case 'o':
-			if err := deleter.Delete(dup.Original.AbsolutePath); err == nil {
-				return []FileHash{dup.Original}, err
-			} else {
-				log.Printf("unable to delete %q: %v", dup.Original.AbsolutePath, err)
-				return []FileHash{}, err
+			if len(dup.Duplicates) == 0 {
+				return []FileHash{}, fmt.Errorf("%q has no duplicate to take its place", dup.Original.AbsolutePath)
+			}
+			// the first duplicate takes the place of the original
+			if !deleteLinks(deleter, dup.Original, dup.Duplicates[0]) {
+				return []FileHash{}, fmt.Errorf("unable to delete %q", dup.Original.AbsolutePath)
 			}
+			return []FileHash{dup.Original}, nil
 		case 's':
 			return []FileHash{}, nil
 		default:
@@ -279,15 +768,19 @@ func PrintDuplicates(duplicates []DuplicateFile) {
 }
 
 // ForceDelete deletes the duplicates without asking for user interventionand returns
-// all of the deleted files
+// all of the deleted files. Since the scan may be stale, every file of a group is checked to still
+// have the size, modification time and hash it was scanned with; groups that changed are skipped.
 func ForceDelete(duplicates []DuplicateFile, deleter Deleter) []FileHash {
 	var deletedFiles []FileHash
 	for _, dup := range duplicates {
+		if err := checkGroupUnchanged(dup); err != nil {
+			log.Printf("skipping %q and its duplicates: %v", dup.Original.AbsolutePath, err)
+			continue
+		}
+
 		for _, f := range dup.Duplicates {
-			if err := deleter.Delete(f.AbsolutePath); err == nil {
+			if deleteLinks(deleter, f, dup.Original) {
 				deletedFiles = append(deletedFiles, f)
-			} else {
-				log.Printf("unable to delete %q: %v", f.AbsolutePath, err)
 			}
 		}
 	}
@@ -322,10 +815,11 @@ func CompileSpaceSeparatedPatterns(s string) ([]*regexp.Regexp, error) {
 // CalculateReport Generates a report detailing basic program behavior
 func CalculateReport(directory Directory, duplicates []DuplicateFile, deletedFiles []FileHash) Report {
 
+	// only count the space that removing the files would actually free
 	sum := func(hashes []FileHash) int64 {
 		sum := int64(0)
 		for _, f := range hashes {
-			sum += f.SizeInBytes
+			sum += f.ReclaimableBytes()
 		}
 		return sum
 	}
@@ -344,13 +838,20 @@ func CalculateReport(directory Directory, duplicates []DuplicateFile, deletedFil
 
 	sumOfDeletedFileSizes := sum(deletedFiles)
 
+	duplicatePercentage := 0.0
+	if len(directory.EncounteredFiles) > 0 {
+		duplicatePercentage = (float64(sumOfDuplicateCount) / float64(len(directory.EncounteredFiles))) * 100
+	}
+
 	return Report{
 		CollectedFileCount:    len(directory.EncounteredFiles),
 		CollectedFileSizeInKB: float64(sumOfFileSizes) / 1000.0,
 		DuplicateFileCount:    sumOfDuplicateCount,
 		DuplicateFileSizeInKB: float64(sumOfDuplicateSizes) / 1000.0,
-		DuplicatePercentage:   (float64(sumOfDuplicateCount) / float64(len(directory.EncounteredFiles))) * 100,
+		DuplicatePercentage:   duplicatePercentage,
 		DeletedFileCount:      len(deletedFiles),
 		DeletedFileSizeInKB:   float64(sumOfDeletedFileSizes) / 1000.0,
+		SizeStageSkippedKB:    float64(directory.Stats.SizeStageSkippedBytes) / 1000.0,
+		PartialStageSkippedKB: float64(directory.Stats.PartialStageSkippedBytes) / 1000.0,
 	}
 }
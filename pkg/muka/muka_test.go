@@ -1,9 +1,12 @@
 package muka
 
 import (
+	"io/ioutil"
 	"math"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -144,6 +147,28 @@ func TestPromptToDeleteOriginal(t *testing.T) {
 	}
 }
 
+func TestPromptToDeleteOriginalWithoutDuplicates(t *testing.T) {
+	fileHashes, err := CollectFiles(FileCollectionOptions{
+		DirectoryToSearch: getTestingDir("small"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	duplicates := FindDuplicateFiles(fileHashes)
+	dup := DuplicateFile{Original: duplicates[0].Original}
+
+	deleter := MakeDeleter(true)
+	reader := strings.NewReader("o\n")
+	var writer strings.Builder
+	deletedFiles, err := PromptToDelete(&writer, reader, deleter, dup)
+	if err == nil {
+		t.Error("removing an original without duplicates should fail")
+	}
+
+	assertEqualsI(t, 0, len(deletedFiles))
+}
+
 func TestPromptToDeleteDuplicates(t *testing.T) {
 	fileHashes, err := CollectFiles(FileCollectionOptions{
 		DirectoryToSearch: getTestingDir("small"),
@@ -355,3 +380,356 @@ func TestCalculateReport(t *testing.T) {
 	assertEqualsI(t, 0, report.DeletedFileCount)
 	assertEqualsF(t, 0.0, report.DeletedFileSizeInKB)
 }
+
+func TestParallelHashingMatchesSequential(t *testing.T) {
+	sequential, err := CollectFiles(FileCollectionOptions{
+		DirectoryToSearch: getTestingDir("small"),
+		Parallelism:       1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parallel, err := CollectFiles(FileCollectionOptions{
+		DirectoryToSearch: getTestingDir("small"),
+		Parallelism:       8,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqualsI(t, len(sequential.HashedFiles), len(parallel.HashedFiles))
+	for i := range sequential.HashedFiles {
+		if !reflect.DeepEqual(sequential.HashedFiles[i], parallel.HashedFiles[i]) {
+			t.Errorf("expected %v but got %v", sequential.HashedFiles[i], parallel.HashedFiles[i])
+		}
+	}
+}
+
+func TestPartialHashSkipsFilesDifferingAtTheEnds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMuka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const partialHashBytes = 4
+	contents := map[string]string{
+		"a.txt": "aaaa-middle-zzzz",
+		"b.txt": "aaaa-middle-zzzz",
+		"c.txt": "bbbb-middle-zzzz",
+	}
+	for name, content := range contents {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d, err := CollectFiles(FileCollectionOptions{
+		DirectoryToSearch: dir,
+		PartialHashBytes:  partialHashBytes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqualsI(t, 2, len(d.HashedFiles))
+	for _, f := range d.HashedFiles {
+		if filepath.Base(f.AbsolutePath) == "c.txt" {
+			t.Errorf("%q should have been ruled out by the partial hash", f.AbsolutePath)
+		}
+	}
+
+	assertEqualsI(t, 0, int(d.Stats.SizeStageSkippedBytes))
+	assertEqualsI(t, len(contents["c.txt"])-2*partialHashBytes, int(d.Stats.PartialStageSkippedBytes))
+}
+
+func TestForceDeleteSkipsGroupsThatChanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMuka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("contents"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d, err := CollectFiles(FileCollectionOptions{
+		DirectoryToSearch: dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	duplicates := FindDuplicateFiles(d)
+
+	// the original is edited after the scan
+	if err := ioutil.WriteFile(duplicates[0].Original.AbsolutePath, []byte("modified"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	deletedFiles := ForceDelete(duplicates, MakeDeleter(false))
+	assertEqualsI(t, 0, len(deletedFiles))
+
+	for _, f := range duplicates[0].Duplicates {
+		if !FileExists(f.AbsolutePath) {
+			t.Errorf("%q should not have been deleted", f.AbsolutePath)
+		}
+	}
+}
+
+func TestOverlappingRootsAreCollectedOnce(t *testing.T) {
+	d, err := CollectFiles(FileCollectionOptions{
+		DirectoryToSearch:   getTestingDir("small"),
+		DirectoriesToSearch: []string{filepath.Join(getTestingDir("small"), "d1"), getTestingDir("small")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	single, err := CollectFiles(FileCollectionOptions{
+		DirectoryToSearch: getTestingDir("small"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqualsI(t, len(single.EncounteredFiles), len(d.EncounteredFiles))
+	assertEqualsI(t, len(single.HashedFiles), len(d.HashedFiles))
+
+	for _, f := range d.EncounteredFiles {
+		expectedRoot := 0
+		if filepath.Base(filepath.Dir(f.AbsolutePath)) == "d1" {
+			expectedRoot = 1
+		}
+		assertEqualsI(t, expectedRoot, f.RootIndex)
+	}
+}
+
+func TestReferenceFilesAreOnlyOriginals(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMuka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		filepath.Join("archive", "a.txt"):   "archived",
+		filepath.Join("archive", "b.txt"):   "archived",
+		filepath.Join("archive", "c.txt"):   "only archived",
+		filepath.Join("downloads", "a.txt"): "archived",
+		filepath.Join("downloads", "d.txt"): "downloaded",
+		filepath.Join("downloads", "e.txt"): "downloaded",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d, err := CollectFiles(FileCollectionOptions{
+		DirectoryToSearch:    filepath.Join(dir, "downloads"),
+		ReferenceDirectories: []string{filepath.Join(dir, "archive")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	duplicates := FindDuplicateFiles(d)
+	assertEqualsI(t, 2, len(duplicates))
+
+	for _, dup := range duplicates {
+		for _, f := range dup.Duplicates {
+			if f.IsReference {
+				t.Errorf("reference file %q should never be a duplicate", f.AbsolutePath)
+			}
+		}
+
+		if strings.HasSuffix(dup.Original.AbsolutePath, "a.txt") && !dup.Original.IsReference {
+			t.Errorf("the reference copy should be the original but got %q", dup.Original.AbsolutePath)
+		}
+	}
+}
+
+func collectedNames(t *testing.T, options FileCollectionOptions) []string {
+	d, err := CollectFiles(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := filepath.Abs(getTestingDir("small"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range d.EncounteredFiles {
+		rel, err := filepath.Rel(root, f.AbsolutePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, filepath.ToSlash(rel))
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func TestCollectFilesDepth(t *testing.T) {
+	all := []string{"d1/file4.txt", "d1/file5.txt", "exclude-me.txt", "file1.txt", "file2.txt", "file3.txt"}
+	tests := []struct {
+		maxDepth, minDepth int
+		expected           []string
+	}{
+		{0, 0, all},
+		{1, 0, []string{"exclude-me.txt", "file1.txt", "file2.txt", "file3.txt"}},
+		{2, 0, all},
+		{0, 1, all},
+		{0, 2, []string{"d1/file4.txt", "d1/file5.txt"}},
+		{1, 2, nil},
+		{0, 3, nil},
+	}
+
+	for _, test := range tests {
+		names := collectedNames(t, FileCollectionOptions{
+			DirectoryToSearch: getTestingDir("small"),
+			MaxDepth:          test.maxDepth,
+			MinDepth:          test.minDepth,
+		})
+		if !reflect.DeepEqual(test.expected, names) {
+			t.Errorf("max depth %d, min depth %d: expected %v but got %v", test.maxDepth, test.minDepth, test.expected, names)
+		}
+	}
+}
+
+func TestCollectFilesDepthIsRelativeToEachRoot(t *testing.T) {
+	names := collectedNames(t, FileCollectionOptions{
+		DirectoryToSearch:   getTestingDir("small"),
+		DirectoriesToSearch: []string{filepath.Join(getTestingDir("small"), "d1")},
+		MaxDepth:            1,
+	})
+
+	expected := []string{"d1/file4.txt", "d1/file5.txt", "exclude-me.txt", "file1.txt", "file2.txt", "file3.txt"}
+	if !reflect.DeepEqual(expected, names) {
+		t.Errorf("expected %v but got %v", expected, names)
+	}
+}
+
+// makeHardLinks creates 'a' and its hard link 'b' along with 'c', a copy of 'a', and its hard link 'd'
+func makeHardLinks(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "TestMuka")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a", "c"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("contents"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for link, target := range map[string]string{"b": "a", "d": "c"} {
+		if err := os.Link(filepath.Join(dir, target), filepath.Join(dir, link)); err != nil {
+			t.Skip(err)
+		}
+	}
+
+	if _, _, ok := fileIdentity(mustStat(t, dir)); !ok {
+		os.RemoveAll(dir)
+		t.Skip("hard links cannot be detected on this platform")
+	}
+
+	return dir
+}
+
+func TestHardLinksAreCollectedAsOneFile(t *testing.T) {
+	dir := makeHardLinks(t)
+	defer os.RemoveAll(dir)
+
+	d, err := CollectFiles(FileCollectionOptions{DirectoryToSearch: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqualsI(t, 2, len(d.EncounteredFiles))
+	for _, f := range d.EncounteredFiles {
+		assertEqualsI(t, 1, len(f.HardLinks))
+	}
+
+	duplicates := FindDuplicateFiles(d)
+	assertEqualsI(t, 1, len(duplicates))
+	assertEqualsI(t, 1, len(duplicates[0].Duplicates))
+
+	if !strings.Contains(duplicates[0].String(), filepath.Join(dir, "d")) {
+		t.Errorf("hard links should be displayed in %q", duplicates[0].String())
+	}
+
+	report := CalculateReport(d, duplicates, nil)
+	assertEqualsF(t, float64(len("contents"))/1000.0, report.DuplicateFileSizeInKB)
+}
+
+func TestHardLinksAreNotDuplicates(t *testing.T) {
+	dir := makeHardLinks(t)
+	defer os.RemoveAll(dir)
+
+	d, err := CollectFiles(FileCollectionOptions{
+		DirectoryToSearch:   filepath.Join(dir, "a"),
+		DirectoriesToSearch: []string{filepath.Join(dir, "b")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqualsI(t, 0, len(FindDuplicateFiles(d)))
+}
+
+func TestForceDeleteRemovesEveryHardLink(t *testing.T) {
+	dir := makeHardLinks(t)
+	defer os.RemoveAll(dir)
+
+	d, err := CollectFiles(FileCollectionOptions{DirectoryToSearch: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	duplicates := FindDuplicateFiles(d)
+	deletedFiles := ForceDelete(duplicates, MakeDeleter(false))
+	assertEqualsI(t, 1, len(deletedFiles))
+
+	for _, name := range []string{"c", "d"} {
+		if FileExists(filepath.Join(dir, name)) {
+			t.Errorf("%q should have been deleted", name)
+		}
+	}
+
+	report := CalculateReport(d, duplicates, deletedFiles)
+	assertEqualsF(t, float64(len("contents"))/1000.0, report.DeletedFileSizeInKB)
+}
+
+func TestReclaimableBytesWithLinksOutsideTheSearch(t *testing.T) {
+	data := FileData{SizeInBytes: 10, Links: 3, HardLinks: []string{"b"}}
+	if data.ReclaimableBytes() != 0 {
+		t.Errorf("expected nothing to be reclaimable but got %d", data.ReclaimableBytes())
+	}
+
+	data.Links = 2
+	if data.ReclaimableBytes() != 10 {
+		t.Errorf("expected 10 reclaimable bytes but got %d", data.ReclaimableBytes())
+	}
+}
+
+func mustStat(t *testing.T, path string) os.FileInfo {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return info
+}
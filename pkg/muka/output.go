@@ -0,0 +1,326 @@
+package muka
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is how a DuplicateWriter writes duplicates
+type Format string
+
+const (
+	// FormatText is colored text meant to be read by people
+	FormatText Format = "text"
+	// FormatJSON is a single JSON object holding every group followed by the report
+	FormatJSON Format = "json"
+	// FormatNDJSON is one JSON object per line for every group, as soon as it is written, followed by the report
+	FormatNDJSON Format = "ndjson"
+	// FormatCSV is one RFC 4180 row per file. The report is written as text on its own.
+	FormatCSV Format = "csv"
+	// FormatFdupes is the output of fdupes: the path of every file of a group on its own line, followed by
+	// a blank line. The report is written as text on its own.
+	FormatFdupes Format = "fdupes"
+)
+
+// Formats lists every supported Format
+var Formats = []Format{FormatText, FormatJSON, FormatNDJSON, FormatCSV, FormatFdupes}
+
+// DuplicateWriter writes groups of duplicates followed by an optional report
+type DuplicateWriter interface {
+	WriteGroup(dup DuplicateFile) error
+	WriteReport(report Report) error
+	// Close writes anything still pending. Nothing may be written afterwards.
+	Close() error
+}
+
+// NewDuplicateWriter is a DuplicateWriter factory function. Formats that cannot hold the report
+// write it to reports instead of w.
+func NewDuplicateWriter(w io.Writer, reports io.Writer, format Format) (DuplicateWriter, error) {
+	switch format {
+	case FormatText, "":
+		return textWriter{w}, nil
+	case FormatJSON:
+		return &jsonWriter{w: w, groups: []groupRecord{}}, nil
+	case FormatNDJSON:
+		return ndjsonWriter{json.NewEncoder(w)}, nil
+	case FormatCSV:
+		return newCSVWriter(w, reports), nil
+	case FormatFdupes:
+		return fdupesWriter{w, reports}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// groupRecord is how a group of duplicates is written as JSON
+type groupRecord struct {
+	// Type tells groups and reports apart when they are written one per line
+	Type       string   `json:"type,omitempty"`
+	Original   string   `json:"original"`
+	Duplicates []string `json:"duplicates"`
+	// HardLinks holds the hard links of the files of the group that have any
+	HardLinks map[string][]string `json:"hard_links,omitempty"`
+	Hash      string              `json:"hash"`
+	Algorithm string              `json:"algorithm"`
+	Size      int64               `json:"size"`
+	// WastedBytes is the space that removing the duplicates would free
+	WastedBytes int64 `json:"wasted_bytes"`
+}
+
+func newGroupRecord(dup DuplicateFile) groupRecord {
+	record := groupRecord{
+		Original:   dup.Original.AbsolutePath,
+		Duplicates: make([]string, 0, len(dup.Duplicates)),
+		Hash:       dup.Original.Hash,
+		Algorithm:  dup.Original.Algorithm,
+		Size:       dup.Original.SizeInBytes,
+	}
+
+	for _, f := range append([]FileHash{dup.Original}, dup.Duplicates...) {
+		if len(f.HardLinks) > 0 {
+			if record.HardLinks == nil {
+				record.HardLinks = make(map[string][]string)
+			}
+			record.HardLinks[f.AbsolutePath] = f.HardLinks
+		}
+	}
+
+	for _, d := range dup.Duplicates {
+		record.Duplicates = append(record.Duplicates, d.AbsolutePath)
+		record.WastedBytes += d.ReclaimableBytes()
+	}
+
+	return record
+}
+
+// reportRecord is how a report is written as JSON
+type reportRecord struct {
+	Type string `json:"type,omitempty"`
+	Report
+}
+
+// textWriter writes duplicates the way PrintDuplicates does
+type textWriter struct {
+	w io.Writer
+}
+
+func (impl textWriter) WriteGroup(dup DuplicateFile) error {
+	_, err := fmt.Fprintln(impl.w, dup)
+
+	return err
+}
+
+func (impl textWriter) WriteReport(report Report) error {
+	_, err := fmt.Fprintln(impl.w, report)
+
+	return err
+}
+
+func (impl textWriter) Close() error {
+
+	return nil
+}
+
+// jsonWriter holds on to every group so they are written as a single document on Close
+type jsonWriter struct {
+	w      io.Writer
+	groups []groupRecord
+	report *reportRecord
+}
+
+func (impl *jsonWriter) WriteGroup(dup DuplicateFile) error {
+	impl.groups = append(impl.groups, newGroupRecord(dup))
+
+	return nil
+}
+
+func (impl *jsonWriter) WriteReport(report Report) error {
+	impl.report = &reportRecord{Report: report}
+
+	return nil
+}
+
+func (impl *jsonWriter) Close() error {
+	encoder := json.NewEncoder(impl.w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(struct {
+		Groups []groupRecord `json:"groups"`
+		Report *reportRecord `json:"report,omitempty"`
+	}{impl.groups, impl.report})
+}
+
+// ndjsonWriter writes every group on its own line as soon as it is given one
+type ndjsonWriter struct {
+	encoder *json.Encoder
+}
+
+func (impl ndjsonWriter) WriteGroup(dup DuplicateFile) error {
+	record := newGroupRecord(dup)
+	record.Type = "group"
+
+	return impl.encoder.Encode(record)
+}
+
+func (impl ndjsonWriter) WriteReport(report Report) error {
+
+	return impl.encoder.Encode(reportRecord{Type: "report", Report: report})
+}
+
+func (impl ndjsonWriter) Close() error {
+
+	return nil
+}
+
+// csvHeader names the columns written by csvWriter
+var csvHeader = []string{"group", "role", "path", "size", "mtime", "owner", "hash"}
+
+// csvWriter writes a row for every file of every group, hard links included. The header is written
+// with the first group, or by Close when there is none, so even an empty result has its columns named.
+type csvWriter struct {
+	w       *csv.Writer
+	reports io.Writer
+	groups  int
+	// wroteHeader is set once the header was written
+	wroteHeader bool
+	// owners caches the names of the users owning files by user ID
+	owners map[string]string
+}
+
+func newCSVWriter(w io.Writer, reports io.Writer) *csvWriter {
+	writer := &csvWriter{
+		w:       csv.NewWriter(w),
+		reports: reports,
+		owners:  make(map[string]string),
+	}
+	// RFC 4180 ends lines with CRLF
+	writer.w.UseCRLF = true
+
+	return writer
+}
+
+func (impl *csvWriter) WriteGroup(dup DuplicateFile) error {
+	if err := impl.writeHeader(); err != nil {
+		return err
+	}
+	impl.groups++
+
+	write := func(f FileHash, role string) error {
+		for _, link := range f.links() {
+			err := impl.w.Write([]string{
+				strconv.Itoa(impl.groups),
+				role,
+				link.AbsolutePath,
+				strconv.FormatInt(link.SizeInBytes, 10),
+				link.ModTime.Format(time.RFC3339),
+				impl.owner(link.AbsolutePath),
+				link.Hash,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := write(dup.Original, "original"); err != nil {
+		return err
+	}
+
+	for _, d := range dup.Duplicates {
+		if err := write(d, "duplicate"); err != nil {
+			return err
+		}
+	}
+
+	return impl.w.Error()
+}
+
+func (impl *csvWriter) WriteReport(report Report) error {
+	_, err := fmt.Fprintln(impl.reports, report)
+
+	return err
+}
+
+func (impl *csvWriter) Close() error {
+	if err := impl.writeHeader(); err != nil {
+		return err
+	}
+	impl.w.Flush()
+
+	return impl.w.Error()
+}
+
+// writeHeader writes the header unless it was already written
+func (impl *csvWriter) writeHeader() error {
+	if impl.wroteHeader {
+		return nil
+	}
+	impl.wroteHeader = true
+
+	return impl.w.Write(csvHeader)
+}
+
+// owner returns the name of the user owning the file at path, or their ID when it has no name.
+// It is empty when the owner is unknown.
+func (impl *csvWriter) owner(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+
+	uid, ok := fileOwner(info)
+	if !ok {
+		return ""
+	}
+
+	if name, cached := impl.owners[uid]; cached {
+		return name
+	}
+
+	name := uid
+	if u, err := user.LookupId(uid); err == nil {
+		name = u.Username
+	}
+	impl.owners[uid] = name
+
+	return name
+}
+
+// fdupesWriter writes groups the way fdupes does so scripts written for it keep working
+type fdupesWriter struct {
+	w       io.Writer
+	reports io.Writer
+}
+
+func (impl fdupesWriter) WriteGroup(dup DuplicateFile) error {
+	var b strings.Builder
+	fmt.Fprintln(&b, dup.Original.AbsolutePath)
+	for _, d := range dup.Duplicates {
+		fmt.Fprintln(&b, d.AbsolutePath)
+	}
+	fmt.Fprintln(&b)
+
+	_, err := io.WriteString(impl.w, b.String())
+
+	return err
+}
+
+func (impl fdupesWriter) WriteReport(report Report) error {
+	_, err := fmt.Fprintln(impl.reports, report)
+
+	return err
+}
+
+func (impl fdupesWriter) Close() error {
+
+	return nil
+}
@@ -0,0 +1,243 @@
+package muka
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func outputDuplicates() []DuplicateFile {
+	file := func(path string, links ...string) FileHash {
+		return FileHash{
+			FileData:  FileData{AbsolutePath: path, SizeInBytes: 10, Links: uint64(1 + len(links)), HardLinks: links},
+			Hash:      "abc",
+			Algorithm: "sha1",
+		}
+	}
+
+	return []DuplicateFile{
+		{Original: file("/a"), Duplicates: []FileHash{file("/b"), file("/c", "/d")}},
+		{Original: file("/e"), Duplicates: []FileHash{file("/f")}},
+	}
+}
+
+func writeOutput(t *testing.T, format Format, withReport bool) string {
+	var b strings.Builder
+	writer, err := NewDuplicateWriter(&b, ioutil.Discard, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dup := range outputDuplicates() {
+		if err := writer.WriteGroup(dup); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if withReport {
+		if err := writer.WriteReport(Report{CollectedFileCount: 6, DuplicateFileCount: 3}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.String()
+}
+
+func TestTextOutput(t *testing.T) {
+	output := writeOutput(t, FormatText, false)
+
+	for _, dup := range outputDuplicates() {
+		if !strings.Contains(output, dup.String()) {
+			t.Errorf("expected %q in %q", dup.String(), output)
+		}
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	var document struct {
+		Groups []groupRecord `json:"groups"`
+		Report *reportRecord `json:"report"`
+	}
+	if err := json.Unmarshal([]byte(writeOutput(t, FormatJSON, true)), &document); err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqualsI(t, 2, len(document.Groups))
+	group := document.Groups[0]
+	if group.Original != "/a" || group.Hash != "abc" || group.Algorithm != "sha1" {
+		t.Errorf("unexpected group %+v", group)
+	}
+	assertEqualsI(t, 2, len(group.Duplicates))
+	assertEqualsI(t, 10, int(group.Size))
+	assertEqualsI(t, 20, int(group.WastedBytes))
+	if links := group.HardLinks["/c"]; len(links) != 1 || links[0] != "/d" {
+		t.Errorf("expected the hard links of /c but got %v", group.HardLinks)
+	}
+
+	if document.Report == nil {
+		t.Fatal("expected a report")
+	}
+	assertEqualsI(t, 6, document.Report.CollectedFileCount)
+
+	// without a report there is no report key at all
+	if strings.Contains(writeOutput(t, FormatJSON, false), "report") {
+		t.Error("unexpected report")
+	}
+}
+
+func TestJSONOutputWithoutDuplicates(t *testing.T) {
+	var b strings.Builder
+	writer, err := NewDuplicateWriter(&b, ioutil.Discard, FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(b.String(), `"groups": []`) {
+		t.Errorf("expected an empty list of groups but got %q", b.String())
+	}
+}
+
+func TestNDJSONOutput(t *testing.T) {
+	scanner := bufio.NewScanner(strings.NewReader(writeOutput(t, FormatNDJSON, true)))
+
+	var types []string
+	for scanner.Scan() {
+		var record map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("%q is not a JSON object: %v", scanner.Text(), err)
+		}
+		types = append(types, record["type"].(string))
+	}
+
+	if strings.Join(types, ",") != "group,group,report" {
+		t.Errorf("expected two groups followed by a report but got %v", types)
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := NewDuplicateWriter(&strings.Builder{}, ioutil.Discard, Format("xml")); err == nil {
+		t.Error("expected an unknown format to be rejected")
+	}
+}
+
+func TestCSVOutput(t *testing.T) {
+	var b strings.Builder
+	var reports strings.Builder
+	writer, err := NewDuplicateWriter(&b, &reports, FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, original, duplicate := makeDuplicates(t)
+	defer os.RemoveAll(dir)
+
+	quoted := duplicate
+	quoted.AbsolutePath = filepath.Join(dir, `a "quoted", name.txt`)
+
+	groups := append([]DuplicateFile{{Original: original, Duplicates: []FileHash{duplicate, quoted}}}, outputDuplicates()...)
+	for _, dup := range groups {
+		if err := writer.WriteGroup(dup); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.WriteReport(Report{CollectedFileCount: 6}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(b.String(), "\r\n") {
+		t.Error("expected rows to end with CRLF")
+	}
+	if !strings.Contains(reports.String(), "Files Scanned: 6") || strings.Contains(b.String(), "Files Scanned") {
+		t.Error("expected the report to be written on its own")
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(b.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the header, three files in the first group, four in the second counting the hard link and two in the last
+	assertEqualsI(t, 10, len(rows))
+	if strings.Join(rows[0], ",") != strings.Join(csvHeader, ",") {
+		t.Errorf("unexpected header %v", rows[0])
+	}
+
+	expected := [][]string{
+		{"1", "original", original.AbsolutePath},
+		{"1", "duplicate", duplicate.AbsolutePath},
+		{"1", "duplicate", quoted.AbsolutePath},
+		{"2", "original", "/a"},
+		{"2", "duplicate", "/b"},
+		{"2", "duplicate", "/c"},
+		{"2", "duplicate", "/d"},
+		{"3", "original", "/e"},
+		{"3", "duplicate", "/f"},
+	}
+	for i, columns := range expected {
+		row := rows[i+1]
+		if row[0] != columns[0] || row[1] != columns[1] || row[2] != columns[2] {
+			t.Errorf("expected row %d to start with %v but got %v", i+1, columns, row)
+		}
+	}
+
+	row := rows[1]
+	assertEqualsI(t, int(original.SizeInBytes), mustAtoi(t, row[3]))
+	if _, err := time.Parse(time.RFC3339, row[4]); err != nil {
+		t.Errorf("unexpected modification time %q: %v", row[4], err)
+	}
+	if _, ok := fileOwner(mustStat(t, original.AbsolutePath)); ok && row[5] == "" {
+		t.Error("expected the owner of the file")
+	}
+	if row[6] != original.Hash {
+		t.Errorf("expected hash %q but got %q", original.Hash, row[6])
+	}
+}
+
+func mustAtoi(t *testing.T, s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+func TestCSVOutputWritesHeaderLazily(t *testing.T) {
+	var b strings.Builder
+	writer, err := NewDuplicateWriter(&b, ioutil.Discard, FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the csv writer buffers its rows so flush them out by hand
+	writer.(*csvWriter).w.Flush()
+	if b.Len() != 0 {
+		t.Errorf("expected nothing to be written before the first group but got %q", b.String())
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.String() != strings.Join(csvHeader, ",")+"\r\n" {
+		t.Errorf("expected only the header without duplicates but got %q", b.String())
+	}
+}
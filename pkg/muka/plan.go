@@ -0,0 +1,222 @@
+package muka
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+)
+
+const planVersion = 1
+
+// ActionKeep marks a file of a Plan that is left untouched. The first kept file of a group is
+// the original the other files of the group are disposed of in favor of.
+const ActionKeep Action = "keep"
+
+// Plan is a reviewable record of the duplicates that were found and of the action to take on each file
+type Plan struct {
+	Version   int         `json:"version"`
+	CreatedAt time.Time   `json:"created_at"`
+	Groups    []PlanGroup `json:"groups"`
+	// LinkStyle, QuarantineDir, Roots and Protected configure the actions as DeleterOptions would
+	LinkStyle     LinkStyle `json:"link_style,omitempty"`
+	QuarantineDir string    `json:"quarantine_dir,omitempty"`
+	Roots         []string  `json:"roots,omitempty"`
+	Protected     []string  `json:"protected,omitempty"`
+}
+
+// PlanGroup is a group of identical files
+type PlanGroup struct {
+	Files []PlannedFile `json:"files"`
+}
+
+// PlannedFile is a file of a PlanGroup as it was when the plan was made
+type PlannedFile struct {
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"mtime"`
+	Hash      string    `json:"hash"`
+	Algorithm string    `json:"algorithm"`
+	Action    Action    `json:"action"`
+}
+
+func (f PlannedFile) fileHash() FileHash {
+
+	return FileHash{
+		FileData: FileData{
+			AbsolutePath: f.Path,
+			SizeInBytes:  f.Size,
+			ModTime:      f.ModTime,
+		},
+		Hash:      f.Hash,
+		Algorithm: f.Algorithm,
+	}
+}
+
+func plannedFile(hash FileHash, action Action) PlannedFile {
+
+	return PlannedFile{
+		Path:      hash.AbsolutePath,
+		Size:      hash.SizeInBytes,
+		ModTime:   hash.ModTime,
+		Hash:      hash.Hash,
+		Algorithm: hash.Algorithm,
+		Action:    action,
+	}
+}
+
+// NewPlan plans to keep the original of every group and to dispose of its duplicates with options.Action
+func NewPlan(duplicates []DuplicateFile, options DeleterOptions) Plan {
+
+	plan := Plan{
+		Version:       planVersion,
+		CreatedAt:     time.Now(),
+		Groups:        make([]PlanGroup, 0, len(duplicates)),
+		LinkStyle:     options.LinkStyle,
+		QuarantineDir: options.QuarantineDir,
+		Roots:         options.Roots,
+		Protected:     options.Protected,
+	}
+
+	for _, dup := range duplicates {
+		var group PlanGroup
+		for _, link := range dup.Original.links() {
+			group.Files = append(group.Files, plannedFile(link, ActionKeep))
+		}
+		// every hard link of a duplicate has to go for its space to be reclaimed
+		for _, d := range dup.Duplicates {
+			for _, link := range d.links() {
+				group.Files = append(group.Files, plannedFile(link, options.Action))
+			}
+		}
+		plan.Groups = append(plan.Groups, group)
+	}
+
+	return plan
+}
+
+// WritePlan writes the plan as indented JSON
+func WritePlan(w io.Writer, plan Plan) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(plan)
+}
+
+// ReadPlan reads a plan written by WritePlan
+func ReadPlan(r io.Reader) (Plan, error) {
+	var plan Plan
+	if err := json.NewDecoder(r).Decode(&plan); err != nil {
+		return Plan{}, err
+	}
+
+	if plan.Version != planVersion {
+		return Plan{}, fmt.Errorf("unsupported plan version %d", plan.Version)
+	}
+
+	return plan, nil
+}
+
+// ApplyPlan carries out the actions of the plan and returns the files that were acted upon.
+// Before acting on a group, every file of the group is checked to still have the size, modification
+// time and hash recorded in the plan. Groups that changed, or that keep no file, are skipped.
+func ApplyPlan(plan Plan, isDryRun bool, journal *Journal) ([]FileHash, error) {
+
+	deleters := make(map[Action]Deleter)
+	deleterFor := func(action Action) (Deleter, error) {
+		if deleter, exists := deleters[action]; exists {
+			return deleter, nil
+		}
+
+		deleter, err := NewDeleter(DeleterOptions{
+			Action:        action,
+			IsDryRun:      isDryRun,
+			LinkStyle:     plan.LinkStyle,
+			QuarantineDir: plan.QuarantineDir,
+			Roots:         plan.Roots,
+			Journal:       journal,
+			Protected:     plan.Protected,
+		})
+		if err != nil {
+			return nil, err
+		}
+		deleters[action] = deleter
+
+		return deleter, nil
+	}
+
+	// reject unknown actions up front rather than half way through the plan
+	for _, group := range plan.Groups {
+		for _, f := range group.Files {
+			if f.Action == ActionKeep {
+				continue
+			}
+			if _, err := deleterFor(f.Action); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var appliedFiles []FileHash
+	for i, group := range plan.Groups {
+		if err := checkPlanGroup(group); err != nil {
+			log.Printf("skipping group %d: %v", i+1, err)
+			continue
+		}
+
+		var original FileHash
+		for _, f := range group.Files {
+			if f.Action == ActionKeep {
+				original = f.fileHash()
+				break
+			}
+		}
+
+		for _, f := range group.Files {
+			if f.Action == ActionKeep {
+				continue
+			}
+
+			deleter, _ := deleterFor(f.Action)
+			if err := deleter.Delete(f.fileHash(), original); err == nil {
+				appliedFiles = append(appliedFiles, f.fileHash())
+			} else {
+				log.Printf("unable to %s %q: %v", f.Action, f.Path, err)
+			}
+		}
+	}
+
+	return appliedFiles, nil
+}
+
+// checkPlanGroup ensures the group keeps at least one file, that all of its files have the hash of the
+// first kept file and that none of its files changed
+func checkPlanGroup(group PlanGroup) error {
+	var kept *PlannedFile
+	for i, f := range group.Files {
+		if f.Action == ActionKeep {
+			kept = &group.Files[i]
+			break
+		}
+	}
+
+	if kept == nil {
+		return fmt.Errorf("no file of the group is kept")
+	}
+
+	// a plan edited by hand may group files that are not duplicates at all
+	for _, f := range group.Files {
+		if f.Hash != kept.Hash || f.Algorithm != kept.Algorithm {
+			return fmt.Errorf("%q is not a duplicate of %q", f.Path, kept.Path)
+		}
+	}
+
+	for _, f := range group.Files {
+		if err := checkUnchanged(f.fileHash()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
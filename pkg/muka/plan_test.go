@@ -0,0 +1,146 @@
+package muka
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func planDuplicates(t *testing.T, dir string) Plan {
+	d, err := CollectFiles(FileCollectionOptions{
+		DirectoryToSearch: dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan := NewPlan(FindDuplicateFiles(d), DeleterOptions{Action: ActionDelete})
+
+	// the plan must survive being written out for review
+	var b bytes.Buffer
+	if err := WritePlan(&b, plan); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err = ReadPlan(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return plan
+}
+
+func TestApplyPlanActsOnPlannedFiles(t *testing.T) {
+	dir, original, duplicate := makeDuplicates(t)
+	defer os.RemoveAll(dir)
+
+	plan := planDuplicates(t, dir)
+	assertEqualsI(t, 1, len(plan.Groups))
+	assertEqualsI(t, 2, len(plan.Groups[0].Files))
+
+	appliedFiles, err := ApplyPlan(plan, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqualsI(t, 1, len(appliedFiles))
+	if FileExists(original.AbsolutePath) == FileExists(duplicate.AbsolutePath) {
+		t.Error("exactly one of the files should have been deleted")
+	}
+}
+
+func TestApplyPlanSkipsChangedGroups(t *testing.T) {
+	dir, original, duplicate := makeDuplicates(t)
+	defer os.RemoveAll(dir)
+
+	plan := planDuplicates(t, dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "original.txt"), []byte("modified"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	appliedFiles, err := ApplyPlan(plan, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqualsI(t, 0, len(appliedFiles))
+	if !FileExists(original.AbsolutePath) || !FileExists(duplicate.AbsolutePath) {
+		t.Error("no file of a changed group should be deleted")
+	}
+}
+
+func TestApplyPlanSkipsGroupsWithoutKeptFile(t *testing.T) {
+	dir, original, duplicate := makeDuplicates(t)
+	defer os.RemoveAll(dir)
+
+	plan := planDuplicates(t, dir)
+	for i := range plan.Groups[0].Files {
+		plan.Groups[0].Files[i].Action = ActionDelete
+	}
+
+	appliedFiles, err := ApplyPlan(plan, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqualsI(t, 0, len(appliedFiles))
+	if !FileExists(original.AbsolutePath) || !FileExists(duplicate.AbsolutePath) {
+		t.Error("a group must keep at least one file")
+	}
+}
+
+func TestApplyPlanSkipsGroupsOfDifferentFiles(t *testing.T) {
+	dir, _, _ := makeDuplicates(t)
+	defer os.RemoveAll(dir)
+
+	plan := planDuplicates(t, dir)
+
+	// a file of the same size but with other contents is slipped into the group with its own, correct, hash
+	other := filepath.Join(dir, "other.txt")
+	if err := ioutil.WriteFile(other, []byte("CONTENTS"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := hashFile(DefaultHasher(), other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := mustStat(t, other)
+
+	for i, f := range plan.Groups[0].Files {
+		if f.Action != ActionKeep {
+			plan.Groups[0].Files[i] = PlannedFile{
+				Path:      other,
+				Size:      info.Size(),
+				ModTime:   info.ModTime(),
+				Hash:      hash,
+				Algorithm: f.Algorithm,
+				Action:    ActionDelete,
+			}
+		}
+	}
+
+	appliedFiles, err := ApplyPlan(plan, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqualsI(t, 0, len(appliedFiles))
+	if !FileExists(other) {
+		t.Error("a file that is not a duplicate of the kept file should not be deleted")
+	}
+}
+
+func TestApplyPlanRejectsUnknownActions(t *testing.T) {
+	dir, _, _ := makeDuplicates(t)
+	defer os.RemoveAll(dir)
+
+	plan := planDuplicates(t, dir)
+	plan.Groups[0].Files[1].Action = "shred"
+
+	if _, err := ApplyPlan(plan, false, nil); err == nil {
+		t.Error("an unknown action should be rejected")
+	}
+}
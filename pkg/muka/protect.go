@@ -0,0 +1,99 @@
+package muka
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// protectingDeleter refuses to act on any file under a protected directory
+type protectingDeleter struct {
+	deleter   Deleter
+	protected []string
+}
+
+func (impl protectingDeleter) Delete(duplicate, original FileHash) error {
+	if dir, protected := underAny(duplicate.AbsolutePath, impl.protected); protected {
+		return fmt.Errorf("%q is protected by %q", duplicate.AbsolutePath, dir)
+	}
+
+	return impl.deleter.Delete(duplicate, original)
+}
+
+// resolveDirs returns the absolute form of every directory, with symbolic links resolved when possible
+func resolveDirs(dirs []string) ([]string, error) {
+	resolved := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		if real, err := filepath.EvalSymlinks(abs); err == nil {
+			abs = real
+		}
+
+		resolved = append(resolved, abs)
+	}
+
+	return resolved, nil
+}
+
+// AbsolutePaths returns the absolute form of every path
+func AbsolutePaths(paths []string) ([]string, error) {
+	abs := make([]string, 0, len(paths))
+	for _, path := range paths {
+		a, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		abs = append(abs, a)
+	}
+
+	return abs, nil
+}
+
+// deepestRoot returns the index of the most specific of the roots containing path, or -1 when none does
+func deepestRoot(path string, roots []string) int {
+	deepest := -1
+	for i, root := range roots {
+		if isUnder(path, root) && (deepest < 0 || len(root) > len(roots[deepest])) {
+			deepest = i
+		}
+	}
+
+	return deepest
+}
+
+// underAny returns the first of the resolved dirs containing path. Both the path as given and the path
+// with its symbolic links resolved are considered so that no link leads around the check.
+func underAny(path string, dirs []string) (string, bool) {
+	if len(dirs) == 0 {
+		return "", false
+	}
+
+	candidates := []string{path}
+	if real, err := filepath.EvalSymlinks(filepath.Dir(path)); err == nil {
+		candidates = append(candidates, filepath.Join(real, filepath.Base(path)))
+	}
+
+	for _, dir := range dirs {
+		for _, candidate := range candidates {
+			if isUnder(candidate, dir) {
+				return dir, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// isUnder reports whether path is dir or lies anywhere beneath it
+func isUnder(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
@@ -0,0 +1,110 @@
+package muka
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// makeLibrary creates identical files in a 'library' and an 'imports' directory
+func makeLibrary(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "TestMuka")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sub := range []string{"imports", "library"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, sub, "photo.jpg"), []byte("contents"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestPreferredDirectoriesHoldOriginals(t *testing.T) {
+	dir := makeLibrary(t)
+	defer os.RemoveAll(dir)
+
+	for _, options := range []FileCollectionOptions{
+		{DirectoryToSearch: dir, PreferredDirectories: []string{filepath.Join(dir, "library")}},
+		{DirectoryToSearch: dir, ProtectedDirectories: []string{filepath.Join(dir, "library")}},
+	} {
+		d, err := CollectFiles(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// lexical order would otherwise keep the copy under imports
+		duplicates := FindDuplicateFiles(d)
+		assertEqualsI(t, 1, len(duplicates))
+
+		if filepath.Base(filepath.Dir(duplicates[0].Original.AbsolutePath)) != "library" {
+			t.Errorf("expected the original to be in the library but got %q", duplicates[0].Original.AbsolutePath)
+		}
+	}
+}
+
+func TestProtectedFilesAreNeverDeleted(t *testing.T) {
+	dir := makeLibrary(t)
+	defer os.RemoveAll(dir)
+
+	library := fileHashOf(filepath.Join(dir, "library", "photo.jpg"))
+	imported := fileHashOf(filepath.Join(dir, "imports", "photo.jpg"))
+
+	for _, action := range Actions {
+		deleter, err := NewDeleter(DeleterOptions{
+			Action:        action,
+			QuarantineDir: filepath.Join(dir, "quarantine"),
+			Roots:         []string{dir},
+			Protected:     []string{filepath.Join(dir, "library")},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := deleter.Delete(library, imported); err == nil {
+			t.Errorf("%s: acting on a protected file should fail", action)
+		}
+
+		if !FileExists(library.AbsolutePath) {
+			t.Fatalf("%s: the protected file should not have been touched", action)
+		}
+	}
+}
+
+func TestProtectedFilesAreNeverDeletedByAnyDeleter(t *testing.T) {
+	dir := makeLibrary(t)
+	defer os.RemoveAll(dir)
+
+	d, err := CollectFiles(FileCollectionOptions{
+		DirectoryToSearch:    dir,
+		ProtectedDirectories: []string{filepath.Join(dir, "library"), filepath.Join(dir, "imports")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	duplicates := FindDuplicateFiles(d)
+	assertEqualsI(t, 1, len(duplicates))
+
+	// the deleters of MakeDeleter know nothing of protected directories
+	deletedFiles := ForceDelete(duplicates, MakeDeleter(false))
+	assertEqualsI(t, 0, len(deletedFiles))
+
+	var writer strings.Builder
+	if _, err := PromptToDelete(&writer, strings.NewReader("o\n"), MakeDeleter(false), duplicates[0]); err == nil {
+		t.Error("removing a protected original should fail")
+	}
+
+	for _, sub := range []string{"imports", "library"} {
+		if !FileExists(filepath.Join(dir, sub, "photo.jpg")) {
+			t.Errorf("the protected file in %q should not have been touched", sub)
+		}
+	}
+}
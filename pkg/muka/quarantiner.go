@@ -0,0 +1,181 @@
+package muka
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// QuarantineManifestName is the name of the manifest written at the top of the quarantine directory
+const QuarantineManifestName = "muka-manifest.jsonl"
+
+// QuarantineRecord describes a single file moved into quarantine
+type QuarantineRecord struct {
+	Time            time.Time `json:"time"`
+	Path            string    `json:"path"`
+	QuarantinedPath string    `json:"quarantined_path"`
+	Original        string    `json:"original"`
+	Hash            string    `json:"hash"`
+	Algorithm       string    `json:"algorithm"`
+	Reason          string    `json:"reason"`
+}
+
+// quarantiner moves duplicates under a quarantine directory mirroring their path relative to the root
+// they were found under and records every move in a manifest
+type quarantiner struct {
+	dir     string
+	roots   []string
+	journal *Journal
+}
+
+func (impl quarantiner) Delete(duplicate, original FileHash) error {
+	if err := os.MkdirAll(impl.dir, 0755); err != nil {
+		return err
+	}
+
+	destination, err := moveToQuarantine(duplicate.AbsolutePath, quarantinePath(impl.dir, impl.roots, duplicate.AbsolutePath))
+	if err != nil {
+		return err
+	}
+
+	record := QuarantineRecord{
+		Time:            time.Now(),
+		Path:            duplicate.AbsolutePath,
+		QuarantinedPath: destination,
+		Original:        original.AbsolutePath,
+		Hash:            duplicate.Hash,
+		Algorithm:       duplicate.Algorithm,
+		Reason:          fmt.Sprintf("duplicate of %s", original.AbsolutePath),
+	}
+
+	recordOperation(impl.journal, ActionQuarantine, duplicate, original, destination)
+
+	// the file is already safe in quarantine so a manifest that cannot be written is no reason to fail
+	if err := appendQuarantineRecord(filepath.Join(impl.dir, QuarantineManifestName), record); err != nil {
+		log.Printf("unable to record %q in the quarantine manifest: %v", destination, err)
+	}
+
+	return nil
+}
+
+// quarantinePath returns where path is placed under the quarantine directory. Paths outside of every root
+// mirror their absolute path instead.
+func quarantinePath(dir string, roots []string, path string) string {
+	if i := deepestRoot(path, roots); i >= 0 {
+		if rel, err := filepath.Rel(roots[i], path); err == nil {
+			return filepath.Join(dir, rel)
+		}
+	}
+
+	return filepath.Join(dir, strings.TrimPrefix(path[len(filepath.VolumeName(path)):], string(filepath.Separator)))
+}
+
+// moveToQuarantine moves path to destination, or next to it under a numbered name when it is taken,
+// and returns where the file ended up
+func moveToQuarantine(path, destination string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return "", err
+	}
+
+	for i := 1; ; i++ {
+		candidate := destination
+		if i > 1 {
+			candidate = fmt.Sprintf("%s.%d", destination, i)
+		}
+
+		if err := moveFile(path, candidate); err != nil {
+			if os.IsExist(err) {
+				continue
+			}
+			return "", err
+		}
+
+		return candidate, nil
+	}
+}
+
+// moveFile moves src to dst without ever replacing an existing dst, in which case an error
+// satisfying os.IsExist is returned. dst is claimed by hard linking src to it, which fails when dst
+// exists, and src is only removed afterwards. When they are on different filesystems, or the
+// filesystem has no hard links, src is copied to a new dst, synced to disk and only then removed.
+func moveFile(src, dst string) error {
+	if err := os.Link(src, dst); err != nil {
+		if os.IsExist(err) || os.IsNotExist(err) {
+			return err
+		}
+
+		if err := copyFile(src, dst); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(src); err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	return nil
+}
+
+// copyFile copies src to the new file dst preserving its permissions and modification time
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// appendQuarantineRecord appends the record to the manifest as a single line of JSON
+func appendQuarantineRecord(manifestPath string, record QuarantineRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := os.OpenFile(manifestPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := manifest.Write(append(line, '\n')); err != nil {
+		manifest.Close()
+		return err
+	}
+
+	return manifest.Close()
+}
@@ -0,0 +1,152 @@
+package muka
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQuarantinerMirrorsTreeAndWritesManifest(t *testing.T) {
+	dir, original, duplicate := makeDuplicates(t)
+	defer os.RemoveAll(dir)
+
+	quarantineDir := filepath.Join(dir, "quarantine")
+	deleter, err := NewDeleter(DeleterOptions{
+		Action:        ActionQuarantine,
+		QuarantineDir: quarantineDir,
+		Roots:         []string{dir},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// quarantining the same path twice must keep both copies
+	for i := 0; i < 2; i++ {
+		if err := ioutil.WriteFile(duplicate.AbsolutePath, []byte("contents"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := deleter.Delete(duplicate, original); err != nil {
+			t.Fatal(err)
+		}
+
+		if FileExists(duplicate.AbsolutePath) {
+			t.Error("the duplicate should have been moved into quarantine")
+		}
+	}
+
+	for _, name := range []string{"duplicate.txt", "duplicate.txt.2"} {
+		if !FileExists(filepath.Join(quarantineDir, name)) {
+			t.Errorf("%q should be in quarantine", name)
+		}
+	}
+
+	manifest, err := os.Open(filepath.Join(quarantineDir, QuarantineManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manifest.Close()
+
+	var records []QuarantineRecord
+	scanner := bufio.NewScanner(manifest)
+	for scanner.Scan() {
+		var record QuarantineRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+
+	assertEqualsI(t, 2, len(records))
+	for _, record := range records {
+		if record.Path != duplicate.AbsolutePath || record.Original != original.AbsolutePath {
+			t.Errorf("unexpected manifest record %+v", record)
+		}
+	}
+}
+
+func TestMoveToQuarantineNeverReplacesFiles(t *testing.T) {
+	dir, _, duplicate := makeDuplicates(t)
+	defer os.RemoveAll(dir)
+
+	taken := filepath.Join(dir, "quarantine", "duplicate.txt")
+	if err := os.MkdirAll(filepath.Dir(taken), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(taken, []byte("already quarantined"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	destination, err := moveToQuarantine(duplicate.AbsolutePath, taken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if destination != taken+".2" {
+		t.Errorf("expected the duplicate to be moved to %q but got %q", taken+".2", destination)
+	}
+
+	contents, err := ioutil.ReadFile(taken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "already quarantined" {
+		t.Error("a file already in quarantine should never be replaced")
+	}
+
+	if FileExists(duplicate.AbsolutePath) {
+		t.Error("the duplicate should have been moved into quarantine")
+	}
+}
+
+func TestQuarantinerWithoutManifestStillSucceeds(t *testing.T) {
+	dir, original, duplicate := makeDuplicates(t)
+	defer os.RemoveAll(dir)
+
+	// a directory in place of the manifest makes appending to it fail
+	quarantineDir := filepath.Join(dir, "quarantine")
+	if err := os.MkdirAll(filepath.Join(quarantineDir, QuarantineManifestName), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	deleter, err := NewDeleter(DeleterOptions{
+		Action:        ActionQuarantine,
+		QuarantineDir: quarantineDir,
+		Roots:         []string{dir},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := deleter.Delete(duplicate, original); err != nil {
+		t.Errorf("a file moved into quarantine should not be reported as a failure: %v", err)
+	}
+
+	if FileExists(duplicate.AbsolutePath) || !FileExists(filepath.Join(quarantineDir, "duplicate.txt")) {
+		t.Error("the duplicate should have been moved into quarantine")
+	}
+}
+
+func TestQuarantinePathOutsideOfRoot(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "root")
+	quarantineDir := filepath.Join(string(filepath.Separator), "quarantine")
+
+	inside := quarantinePath(quarantineDir, []string{root}, filepath.Join(root, "a", "b.txt"))
+	if inside != filepath.Join(quarantineDir, "a", "b.txt") {
+		t.Errorf("unexpected quarantine path %q", inside)
+	}
+
+	outside := quarantinePath(quarantineDir, []string{root}, filepath.Join(string(filepath.Separator), "elsewhere", "b.txt"))
+	if outside != filepath.Join(quarantineDir, "elsewhere", "b.txt") {
+		t.Errorf("unexpected quarantine path %q", outside)
+	}
+}
+
+func TestNewDeleterRequiresQuarantineDir(t *testing.T) {
+	if _, err := NewDeleter(DeleterOptions{Action: ActionQuarantine}); err == nil {
+		t.Error("the quarantine action should require a directory")
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package muka
+
+import (
+	"os"
+)
+
+// fileIdentity returns the device and inode numbers identifying the file described by info
+// and whether they are available on this platform
+func fileIdentity(info os.FileInfo) (device uint64, inode uint64, ok bool) {
+
+	return 0, 0, false
+}
+
+// fileOwner returns the user ID of the owner of the file described by info and whether it is available on this platform
+func fileOwner(info os.FileInfo) (uid string, ok bool) {
+
+	return "", false
+}
+
+// linkCount returns the number of hard links to the file described by info
+func linkCount(info os.FileInfo) uint64 {
+
+	return 1
+}
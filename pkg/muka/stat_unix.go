@@ -0,0 +1,41 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package muka
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// fileIdentity returns the device and inode numbers identifying the file described by info
+// and whether they are available on this platform
+func fileIdentity(info os.FileInfo) (device uint64, inode uint64, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+
+	return uint64(stat.Dev), uint64(stat.Ino), true
+}
+
+// fileOwner returns the user ID of the owner of the file described by info and whether it is available on this platform
+func fileOwner(info os.FileInfo) (uid string, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", false
+	}
+
+	return strconv.FormatUint(uint64(stat.Uid), 10), true
+}
+
+// linkCount returns the number of hard links to the file described by info
+func linkCount(info os.FileInfo) uint64 {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 1
+	}
+
+	return uint64(stat.Nlink)
+}
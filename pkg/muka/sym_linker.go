@@ -0,0 +1,55 @@
+package muka
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// symLinker replaces duplicates with symbolic links to their original
+type symLinker struct {
+	linkStyle LinkStyle
+	journal   *Journal
+}
+
+func (impl symLinker) Delete(duplicate, original FileHash) error {
+	originalInfo, err := os.Stat(original.AbsolutePath)
+	if err != nil {
+		return err
+	}
+
+	// following the duplicate catches it already being a link to the original
+	duplicateInfo, err := os.Stat(duplicate.AbsolutePath)
+	if err != nil {
+		return err
+	}
+
+	if os.SameFile(originalInfo, duplicateInfo) {
+		return fmt.Errorf("%q already refers to %q", duplicate.AbsolutePath, original.AbsolutePath)
+	}
+
+	target, err := symlinkTarget(duplicate, original, impl.linkStyle)
+	if err != nil {
+		return err
+	}
+
+	err = replaceAtomically(duplicate.AbsolutePath, func(tmp string) error {
+		return os.Symlink(target, tmp)
+	})
+	if err != nil {
+		return err
+	}
+
+	recordOperation(impl.journal, ActionSymlink, duplicate, original, "")
+
+	return nil
+}
+
+// symlinkTarget returns the target of a symbolic link placed at duplicate pointing to original
+func symlinkTarget(duplicate, original FileHash, linkStyle LinkStyle) (string, error) {
+	if linkStyle != LinkStyleRelative {
+		return original.AbsolutePath, nil
+	}
+
+	return filepath.Rel(filepath.Dir(duplicate.AbsolutePath), original.AbsolutePath)
+}
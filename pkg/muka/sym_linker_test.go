@@ -0,0 +1,84 @@
+package muka
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSymLinkerReplacesDuplicateWithLink(t *testing.T) {
+	linkStyles := map[LinkStyle]string{
+		LinkStyleAbsolute: "",
+		LinkStyleRelative: "original.txt",
+	}
+
+	for linkStyle, expectedTarget := range linkStyles {
+		dir, original, duplicate := makeDuplicates(t)
+		defer os.RemoveAll(dir)
+
+		if expectedTarget == "" {
+			expectedTarget = original.AbsolutePath
+		}
+
+		deleter, err := NewDeleter(DeleterOptions{Action: ActionSymlink, LinkStyle: linkStyle})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := deleter.Delete(duplicate, original); err != nil {
+			t.Fatal(err)
+		}
+
+		target, err := os.Readlink(duplicate.AbsolutePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if target != expectedTarget {
+			t.Errorf("expected a %s link to %q but got %q", linkStyle, expectedTarget, target)
+		}
+
+		contents, err := ioutil.ReadFile(duplicate.AbsolutePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(contents) != "contents" {
+			t.Errorf("the link should resolve to the original but read %q", contents)
+		}
+
+		if err := deleter.Delete(duplicate, original); err == nil {
+			t.Error("linking an existing link should fail")
+		}
+	}
+}
+
+func TestSymLinkerOnDryRunShouldKeepFile(t *testing.T) {
+	dir, original, duplicate := makeDuplicates(t)
+	defer os.RemoveAll(dir)
+
+	deleter, err := NewDeleter(DeleterOptions{Action: ActionSymlink, IsDryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := deleter.Delete(duplicate, original); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Lstat(duplicate.AbsolutePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		t.Errorf("dry run should not link %q", filepath.Base(duplicate.AbsolutePath))
+	}
+}
+
+func TestNewDeleterRejectsUnknownLinkStyle(t *testing.T) {
+	if _, err := NewDeleter(DeleterOptions{Action: ActionSymlink, LinkStyle: "sideways"}); err == nil {
+		t.Error("an unknown link style should be rejected")
+	}
+}
@@ -0,0 +1,185 @@
+package muka
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// trasher moves duplicates to the trash following the freedesktop.org Trash specification
+// (https://specifications.freedesktop.org/trash-spec/trashspec-latest.html) so that
+// desktop file managers can restore them
+type trasher struct {
+	journal *Journal
+}
+
+func (impl trasher) Delete(duplicate, original FileHash) error {
+	trashedPath, err := moveToTrash(duplicate.AbsolutePath, time.Now())
+	if err != nil {
+		return err
+	}
+
+	recordOperation(impl.journal, ActionTrash, duplicate, original, trashedPath)
+
+	return nil
+}
+
+// homeTrashDir returns $XDG_DATA_HOME/Trash falling back on ~/.local/share/Trash
+func homeTrashDir() (string, error) {
+	if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
+		return filepath.Join(dataHome, "Trash"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".local", "share", "Trash"), nil
+}
+
+// trashDirFor returns the trash directory that path should be moved to along with the directory
+// that the path recorded in the trash info is relative to. Files on the same filesystem as the home
+// trash go there and files on any other filesystem go to the trash at the top of their mount.
+func trashDirFor(path string) (trashDir string, topDir string, err error) {
+	home, err := homeTrashDir()
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := makeTrashDir(home); err != nil {
+		return "", "", err
+	}
+
+	homeInfo, err := os.Stat(home)
+	if err != nil {
+		return "", "", err
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	homeDevice, _, ok := fileIdentity(homeInfo)
+	device, _, _ := fileIdentity(info)
+	if !ok || homeDevice == device {
+		// the home trash records absolute paths
+		return home, "", nil
+	}
+
+	topDir, err = mountPoint(path, device)
+	if err != nil {
+		return "", "", err
+	}
+
+	uid := strconv.Itoa(os.Getuid())
+
+	// an administrator provided $topdir/.Trash must be a sticky directory and not a symbolic link
+	if shared, err := os.Lstat(filepath.Join(topDir, ".Trash")); err == nil &&
+		shared.IsDir() && shared.Mode()&os.ModeSticky != 0 {
+		trashDir = filepath.Join(topDir, ".Trash", uid)
+		if err := makeTrashDir(trashDir); err == nil {
+			return trashDir, topDir, nil
+		}
+	}
+
+	trashDir = filepath.Join(topDir, ".Trash-"+uid)
+	if err := makeTrashDir(trashDir); err != nil {
+		return "", "", err
+	}
+
+	return trashDir, topDir, nil
+}
+
+// makeTrashDir creates the files and info subdirectories of a trash directory
+func makeTrashDir(trashDir string) error {
+	for _, sub := range []string{"files", "info"} {
+		if err := os.MkdirAll(filepath.Join(trashDir, sub), 0700); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mountPoint returns the top directory of the filesystem with the given device containing path
+func mountPoint(path string, device uint64) (string, error) {
+	dir := filepath.Dir(path)
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir, nil
+		}
+
+		info, err := os.Stat(parent)
+		if err != nil {
+			return "", err
+		}
+
+		if parentDevice, _, _ := fileIdentity(info); parentDevice != device {
+			return dir, nil
+		}
+
+		dir = parent
+	}
+}
+
+// moveToTrash moves path into the trash and returns the path it was moved to
+func moveToTrash(path string, deletedAt time.Time) (string, error) {
+	trashDir, topDir, err := trashDirFor(path)
+	if err != nil {
+		return "", err
+	}
+
+	recordedPath := path
+	if topDir != "" {
+		if recordedPath, err = filepath.Rel(topDir, path); err != nil {
+			return "", err
+		}
+	}
+
+	// The info file is created exclusively first to claim a unique name in the trash
+	base := filepath.Base(path)
+	for i := 1; ; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s.%d", base, i)
+		}
+
+		trashedPath := filepath.Join(trashDir, "files", name)
+		if _, err := os.Lstat(trashedPath); err == nil {
+			continue
+		}
+
+		infoPath := filepath.Join(trashDir, "info", name+".trashinfo")
+		info, err := os.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		_, err = fmt.Fprintf(info, "[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+			(&url.URL{Path: filepath.ToSlash(recordedPath)}).EscapedPath(),
+			deletedAt.Format("2006-01-02T15:04:05"))
+		if closeErr := info.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(infoPath)
+			return "", err
+		}
+
+		if err := os.Rename(path, trashedPath); err != nil {
+			os.Remove(infoPath)
+			return "", err
+		}
+
+		return trashedPath, nil
+	}
+}
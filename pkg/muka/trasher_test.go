@@ -0,0 +1,79 @@
+package muka
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTrasherMovesFileToHomeTrash(t *testing.T) {
+	dir, original, duplicate := makeDuplicates(t)
+	defer os.RemoveAll(dir)
+
+	dataHome := filepath.Join(dir, "data")
+	defer os.Setenv("XDG_DATA_HOME", os.Getenv("XDG_DATA_HOME"))
+	os.Setenv("XDG_DATA_HOME", dataHome)
+
+	deleter, err := NewDeleter(DeleterOptions{Action: ActionTrash})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// trashing two files with the same name must not overwrite the first one
+	for i := 0; i < 2; i++ {
+		if err := ioutil.WriteFile(duplicate.AbsolutePath, []byte("contents"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := deleter.Delete(duplicate, original); err != nil {
+			t.Fatal(err)
+		}
+
+		if FileExists(duplicate.AbsolutePath) {
+			t.Error("the duplicate should have been moved to the trash")
+		}
+	}
+
+	for _, name := range []string{"duplicate.txt", "duplicate.txt.2"} {
+		if !FileExists(filepath.Join(dataHome, "Trash", "files", name)) {
+			t.Errorf("%q should be in the trash", name)
+		}
+
+		info, err := ioutil.ReadFile(filepath.Join(dataHome, "Trash", "info", name+".trashinfo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.HasPrefix(string(info), "[Trash Info]\n") {
+			t.Errorf("unexpected trash info header: %q", info)
+		}
+
+		if !strings.Contains(string(info), "Path="+duplicate.AbsolutePath+"\n") {
+			t.Errorf("the trash info should record the original path: %q", info)
+		}
+
+		if !strings.Contains(string(info), "DeletionDate=") {
+			t.Errorf("the trash info should record the deletion date: %q", info)
+		}
+	}
+}
+
+func TestTrasherOnDryRunShouldKeepFile(t *testing.T) {
+	dir, original, duplicate := makeDuplicates(t)
+	defer os.RemoveAll(dir)
+
+	deleter, err := NewDeleter(DeleterOptions{Action: ActionTrash, IsDryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := deleter.Delete(duplicate, original); err != nil {
+		t.Fatal(err)
+	}
+
+	if !FileExists(duplicate.AbsolutePath) {
+		t.Error("dry run should not trash files")
+	}
+}
@@ -0,0 +1,89 @@
+package muka
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+)
+
+const verifyBufferSize = 64 * 1024
+
+// VerifyDuplicates compares every duplicate byte by byte against its original.
+// Files that do not match the original are split into separate groups, and
+// files that cannot be read are dropped altogether, so the returned duplicates
+// are only ever identical files. The policies choose the original of every group that is split off.
+func VerifyDuplicates(duplicates []DuplicateFile, policies ...KeepPolicy) []DuplicateFile {
+
+	verified := make([]DuplicateFile, 0, len(duplicates))
+	for _, dup := range duplicates {
+		remaining := append([]FileHash{dup.Original}, dup.Duplicates...)
+		for len(remaining) > 1 {
+			group := DuplicateFile{
+				Original:   remaining[0],
+				Duplicates: make([]FileHash, 0),
+			}
+
+			var mismatched []FileHash
+			for _, f := range remaining[1:] {
+				same, err := compareFiles(group.Original.AbsolutePath, f.AbsolutePath)
+				if err != nil {
+					log.Printf("unable to verify %q against %q: %v", f.AbsolutePath, group.Original.AbsolutePath, err)
+				} else if same {
+					group.Duplicates = append(group.Duplicates, f)
+				} else {
+					log.Printf("hash collision: %q and %q share %s hash %s but their contents differ",
+						group.Original.AbsolutePath, f.AbsolutePath, f.Algorithm, f.Hash)
+					mismatched = append(mismatched, f)
+				}
+			}
+
+			if len(group.Duplicates) > 0 {
+				// groups split off are compared against whichever of their files came first, which the policies may not prefer
+				verified = append(verified, selectOriginal(group, policies))
+			}
+
+			remaining = mismatched
+		}
+	}
+
+	return verified
+}
+
+// compareFiles reports whether the two files have identical contents
+func compareFiles(path1, path2 string) (bool, error) {
+	file1, err := os.Open(path1)
+	if err != nil {
+		return false, err
+	}
+	defer file1.Close()
+
+	file2, err := os.Open(path2)
+	if err != nil {
+		return false, err
+	}
+	defer file2.Close()
+
+	buf1 := make([]byte, verifyBufferSize)
+	buf2 := make([]byte, verifyBufferSize)
+	for {
+		n1, err1 := io.ReadFull(file1, buf1)
+		if err1 != nil && err1 != io.EOF && err1 != io.ErrUnexpectedEOF {
+			return false, err1
+		}
+
+		n2, err2 := io.ReadFull(file2, buf2)
+		if err2 != nil && err2 != io.EOF && err2 != io.ErrUnexpectedEOF {
+			return false, err2
+		}
+
+		if !bytes.Equal(buf1[:n1], buf2[:n2]) {
+			return false, nil
+		}
+
+		// a short read means the end of the file was reached
+		if n1 < verifyBufferSize {
+			return true, nil
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package muka
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVerifyDuplicatesKeepsIdenticalFiles(t *testing.T) {
+	d, err := CollectFiles(FileCollectionOptions{
+		DirectoryToSearch: getTestingDir("small"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	duplicates := FindDuplicateFiles(d)
+	verified := VerifyDuplicates(duplicates)
+
+	assertEqualsI(t, len(duplicates), len(verified))
+	assertEqualsI(t, len(duplicates[0].Duplicates), len(verified[0].Duplicates))
+}
+
+func TestVerifyDuplicatesSplitsHashCollisions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMuka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	contents := []string{"aaaa", "bbbb", "aaaa", "bbbb", "cccc"}
+	var hashes []FileHash
+	for i, content := range contents {
+		path := filepath.Join(dir, string(rune('a'+i)))
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// every file claims the same hash to simulate a collision
+		hashes = append(hashes, FileHash{
+			FileData: FileData{AbsolutePath: path, SizeInBytes: int64(len(content))},
+			Hash:     "collision",
+		})
+	}
+
+	verified := VerifyDuplicates(FindDuplicateFiles(Directory{HashedFiles: hashes}))
+
+	assertEqualsI(t, 2, len(verified))
+	for _, dup := range verified {
+		assertEqualsI(t, 1, len(dup.Duplicates))
+	}
+}
+
+func TestVerifyDuplicatesAppliesPoliciesToSplitGroups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMuka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	contents := []string{"aaaa", "bbbb", "bbbb"}
+	var hashes []FileHash
+	for i, content := range contents {
+		path := filepath.Join(dir, string(rune('a'+i)))
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// a is the newest file and c is newer than b
+		modTime := now.Add(-time.Hour)
+		switch i {
+		case 0:
+			modTime = now
+		case 1:
+			modTime = now.Add(-2 * time.Hour)
+		}
+		hashes = append(hashes, FileHash{
+			FileData: FileData{AbsolutePath: path, SizeInBytes: int64(len(content)), ModTime: modTime},
+			Hash:     "collision",
+		})
+	}
+
+	verified := VerifyDuplicates(FindDuplicateFiles(Directory{HashedFiles: hashes}, KeepNewest), KeepNewest)
+
+	assertEqualsI(t, 1, len(verified))
+	if verified[0].Original.AbsolutePath != hashes[2].AbsolutePath {
+		t.Errorf("expected the newest file of the split group to be the original but got %q", verified[0].Original.AbsolutePath)
+	}
+}
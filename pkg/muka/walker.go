@@ -0,0 +1,257 @@
+package muka
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// SkippedSymlink is a symbolic link CollectFiles did not collect or descend into
+type SkippedSymlink struct {
+	Path   string
+	Reason string
+}
+
+// walkFunc is called by walker for every file it collects. path is where the file was found,
+// realPath is the same file with the symbolic links followed along the way resolved and depth
+// is how many levels below the root the file is.
+type walkFunc func(path, realPath string, info os.FileInfo, depth int) error
+
+// walker walks directory trees applying the depth, exclusion, glob, ignore file, filesystem and symbolic link
+// rules of FileCollectionOptions
+type walker struct {
+	options FileCollectionOptions
+	// visiting holds the directories currently being walked so symbolic link loops are detected
+	visiting map[interface{}]bool
+	skipped  []SkippedSymlink
+	// root and rootDevice are the path and the device of the root being walked
+	root       string
+	rootDevice uint64
+	// filesystems holds the type of every mounted filesystem by device when filesystem types are excluded
+	filesystems   map[uint64]string
+	excludedTypes map[string]bool
+}
+
+func newWalker(options FileCollectionOptions) (*walker, error) {
+	w := &walker{
+		options:       options,
+		visiting:      make(map[interface{}]bool),
+		excludedTypes: make(map[string]bool),
+	}
+
+	for _, pattern := range append(append([]string{}, options.IncludePatterns...), options.ExcludePatterns...) {
+		if !doublestar.ValidatePattern(pattern) {
+			return nil, fmt.Errorf("invalid glob pattern %q", pattern)
+		}
+	}
+
+	if len(options.ExcludeFilesystemTypes) > 0 {
+		filesystems, err := filesystemTypes()
+		if err != nil {
+			return nil, err
+		}
+		w.filesystems = filesystems
+
+		for _, fsType := range options.ExcludeFilesystemTypes {
+			w.excludedTypes[fsType] = true
+		}
+	}
+
+	return w, nil
+}
+
+// walk calls fn for every file under root in lexical order. root is followed even when it is a symbolic link.
+func (w *walker) walk(root string, fn walkFunc) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+
+	w.root = root
+	w.rootDevice, _, _ = fileIdentity(info)
+
+	realPath := root
+	if w.options.FollowSymlinks {
+		if realPath, err = filepath.EvalSymlinks(root); err != nil {
+			return err
+		}
+	}
+
+	if !info.IsDir() {
+		if w.skipFile(root, info, 0) {
+			return nil
+		}
+		return fn(root, realPath, info, 0)
+	}
+
+	if w.skipDir(root, info, 0) {
+		return nil
+	}
+
+	return w.walkDir(root, realPath, info, 0, nil, fn)
+}
+
+// walkDir walks the directory at path. rules are the ignore patterns of the directories above it.
+func (w *walker) walkDir(path, realPath string, info os.FileInfo, depth int, rules ignoreRules, fn walkFunc) error {
+	key := directoryKey(realPath, info)
+	if w.visiting[key] {
+		w.skipped = append(w.skipped, SkippedSymlink{Path: path, Reason: "symbolic link loop"})
+		return nil
+	}
+	w.visiting[key] = true
+	defer delete(w.visiting, key)
+
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return err
+	}
+
+	if !w.options.NoIgnore {
+		if rules, err = rules.load(path); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range entries {
+		entryPath := filepath.Join(path, entry.Name())
+		entryRealPath := filepath.Join(realPath, entry.Name())
+		entryInfo := entry
+
+		if entry.Mode()&os.ModeSymlink != 0 {
+			if !w.options.FollowSymlinks {
+				w.skipped = append(w.skipped, SkippedSymlink{Path: entryPath, Reason: "not following symbolic links"})
+				continue
+			}
+
+			if entryRealPath, err = filepath.EvalSymlinks(entryPath); err != nil {
+				w.skipped = append(w.skipped, SkippedSymlink{Path: entryPath, Reason: "broken symbolic link"})
+				continue
+			}
+
+			if entryInfo, err = os.Stat(entryPath); err != nil {
+				return err
+			}
+		}
+
+		if rules.ignored(entryPath, entryInfo.IsDir()) {
+			continue
+		}
+
+		if !w.options.NoIgnore && entryInfo.IsDir() && entry.Name() == gitDirName {
+			continue
+		}
+
+		if entryInfo.IsDir() {
+			if w.skipDir(entryPath, entryInfo, depth+1) {
+				continue
+			}
+
+			if err := w.walkDir(entryPath, entryRealPath, entryInfo, depth+1, rules, fn); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if w.skipFile(entryPath, entryInfo, depth+1) {
+			continue
+		}
+
+		if err := fn(entryPath, entryRealPath, entryInfo, depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// skipDir reports whether the directory at path described by info at depth must not be descended into
+func (w *walker) skipDir(path string, info os.FileInfo, depth int) bool {
+	if w.options.MaxDepth > 0 && depth >= w.options.MaxDepth {
+		return true
+	}
+
+	if w.skipFilesystem(info) {
+		return true
+	}
+
+	for _, excludeDirPattern := range w.options.ExcludeDirs {
+		if excludeDirPattern.MatchString(info.Name()) {
+			return true
+		}
+	}
+
+	// the root itself is never pruned by the patterns relative to it
+	return depth > 0 && matchesAny(w.options.ExcludePatterns, w.relative(path))
+}
+
+// skipFile reports whether the file at path described by info at depth must not be collected
+func (w *walker) skipFile(path string, info os.FileInfo, depth int) bool {
+	if depth < w.options.MinDepth {
+		return true
+	}
+
+	if w.skipFilesystem(info) || w.options.filtered(info) {
+		return true
+	}
+
+	for _, excludeFilePattern := range w.options.ExcludeFiles {
+		if excludeFilePattern.MatchString(info.Name()) {
+			return true
+		}
+	}
+
+	rel := w.relative(path)
+	if len(w.options.IncludePatterns) > 0 && !matchesAny(w.options.IncludePatterns, rel) {
+		return true
+	}
+
+	return matchesAny(w.options.ExcludePatterns, rel)
+}
+
+// relative returns the slash separated path relative to the root being walked that glob patterns are matched against.
+// A root that is a file is known by its name.
+func (w *walker) relative(path string) string {
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil || rel == "." {
+		return filepath.Base(path)
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// matchesAny reports whether any of the glob patterns matches the slash separated path
+func matchesAny(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := doublestar.Match(pattern, path); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// skipFilesystem reports whether the file described by info is on a filesystem that must not be searched
+func (w *walker) skipFilesystem(info os.FileInfo) bool {
+	device, _, ok := fileIdentity(info)
+	if !ok {
+		return false
+	}
+
+	if w.options.OneFileSystem && device != w.rootDevice {
+		return true
+	}
+
+	return w.excludedTypes[w.filesystems[device]]
+}
+
+// directoryKey identifies a directory by its device and inode or, when those are unavailable, by its resolved path
+func directoryKey(realPath string, info os.FileInfo) interface{} {
+	if device, inode, ok := fileIdentity(info); ok {
+		return [2]uint64{device, inode}
+	}
+
+	return realPath
+}
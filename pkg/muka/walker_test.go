@@ -0,0 +1,293 @@
+package muka
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// makeLinkedLibrary adds a 'links' directory to a library holding symbolic links to a directory,
+// to a file and back to the top of the tree
+func makeLinkedLibrary(t *testing.T) string {
+	dir := makeLibrary(t)
+
+	links := filepath.Join(dir, "links")
+	if err := os.Mkdir(links, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, target := range map[string]string{
+		"library":   filepath.Join("..", "library"),
+		"photo.jpg": filepath.Join("..", "library", "photo.jpg"),
+		"loop":      "..",
+	} {
+		if err := os.Symlink(target, filepath.Join(links, name)); err != nil {
+			t.Skip(err)
+		}
+	}
+
+	return dir
+}
+
+func TestSymlinksAreSkippedByDefault(t *testing.T) {
+	dir := makeLinkedLibrary(t)
+	defer os.RemoveAll(dir)
+
+	d, err := CollectFiles(FileCollectionOptions{DirectoryToSearch: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqualsI(t, 2, len(d.EncounteredFiles))
+	assertEqualsI(t, 3, len(d.SkippedSymlinks))
+	for _, skipped := range d.SkippedSymlinks {
+		if filepath.Base(filepath.Dir(skipped.Path)) != "links" {
+			t.Errorf("%q should not have been skipped", skipped.Path)
+		}
+	}
+}
+
+func TestFollowSymlinksCollectsFilesOnce(t *testing.T) {
+	dir := makeLinkedLibrary(t)
+	defer os.RemoveAll(dir)
+
+	d, err := CollectFiles(FileCollectionOptions{DirectoryToSearch: dir, FollowSymlinks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqualsI(t, 2, len(d.EncounteredFiles))
+	for _, f := range d.EncounteredFiles {
+		if filepath.Base(filepath.Dir(f.AbsolutePath)) == "links" {
+			t.Errorf("%q should be known by its real path", f.AbsolutePath)
+		}
+	}
+
+	assertEqualsI(t, 1, len(d.SkippedSymlinks))
+	if d.SkippedSymlinks[0].Path != filepath.Join(dir, "links", "loop") {
+		t.Errorf("expected the loop to be skipped but got %q", d.SkippedSymlinks[0].Path)
+	}
+
+	duplicates := FindDuplicateFiles(d)
+	assertEqualsI(t, 1, len(duplicates))
+	assertEqualsI(t, 1, len(duplicates[0].Duplicates))
+}
+
+func TestFollowSymlinksIntoLinkedRoot(t *testing.T) {
+	dir := makeLinkedLibrary(t)
+	defer os.RemoveAll(dir)
+
+	d, err := CollectFiles(FileCollectionOptions{
+		DirectoryToSearch: filepath.Join(dir, "links"),
+		FollowSymlinks:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// links/loop leads to the whole tree which contains links itself
+	assertEqualsI(t, 2, len(d.EncounteredFiles))
+	assertEqualsI(t, 1, len(d.SkippedSymlinks))
+}
+
+// makeLinkedTree creates a 'search' directory holding a symbolic link to each of the files, which are
+// written next to it with their contents, and returns the top of the tree
+func makeLinkedTree(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "TestMuka")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "search"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		link := filepath.Join(dir, "search", "link-"+filepath.Base(name))
+		if err := os.Symlink(filepath.Join("..", name), link); err != nil {
+			os.RemoveAll(dir)
+			t.Skip(err)
+		}
+	}
+
+	return dir
+}
+
+func TestFilesLinkedFromSearchRootsIntoReferenceRootsAreReferences(t *testing.T) {
+	dir := makeLinkedTree(t, map[string]string{filepath.Join("library", "photo.jpg"): "contents"})
+	defer os.RemoveAll(dir)
+
+	copied := filepath.Join(dir, "search", "photo.jpg")
+	if err := ioutil.WriteFile(copied, []byte("contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// search is walked first so the library photo is first reached through search/link-photo.jpg
+	library := filepath.Join(dir, "library")
+	d, err := CollectFiles(FileCollectionOptions{
+		DirectoryToSearch:    filepath.Join(dir, "search"),
+		ReferenceDirectories: []string{library},
+		FollowSymlinks:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqualsI(t, 2, len(d.EncounteredFiles))
+	for _, f := range d.EncounteredFiles {
+		if expected := filepath.Dir(f.AbsolutePath) == library; f.IsReference != expected {
+			t.Errorf("expected %q to be a reference: %v", f.AbsolutePath, expected)
+		}
+	}
+
+	duplicates := FindDuplicateFiles(d)
+	assertEqualsI(t, 1, len(duplicates))
+	assertEqualsI(t, 1, len(duplicates[0].Duplicates))
+	if duplicates[0].Duplicates[0].AbsolutePath != copied {
+		t.Errorf("expected %q to be the duplicate but got %q", copied, duplicates[0].Duplicates[0].AbsolutePath)
+	}
+}
+
+func TestForceDeleteNeverActsOutsideOfTheRoots(t *testing.T) {
+	dir := makeLinkedTree(t, map[string]string{
+		filepath.Join("outside", "a"): "contents",
+		filepath.Join("outside", "b"): "contents",
+	})
+	defer os.RemoveAll(dir)
+
+	d, err := CollectFiles(FileCollectionOptions{
+		DirectoryToSearch: filepath.Join(dir, "search"),
+		FollowSymlinks:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range d.EncounteredFiles {
+		if filepath.Dir(f.AbsolutePath) != filepath.Join(dir, "search") {
+			t.Errorf("expected %q to be known by the path it was found at", f.AbsolutePath)
+		}
+	}
+
+	deletedFiles := ForceDelete(FindDuplicateFiles(d), MakeDeleter(false))
+
+	assertEqualsI(t, 0, len(deletedFiles))
+	for _, name := range []string{"outside/a", "outside/b", "search/link-a", "search/link-b"} {
+		if !FileExists(filepath.Join(dir, filepath.FromSlash(name))) {
+			t.Errorf("%q should not have been acted upon", name)
+		}
+	}
+}
+
+func TestOneFileSystemStaysOnTheRootDevice(t *testing.T) {
+	dir := makeLibrary(t)
+	defer os.RemoveAll(dir)
+
+	w, err := newWalker(FileCollectionOptions{OneFileSystem: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var collected []string
+	err = w.walk(dir, func(path, realPath string, info os.FileInfo, depth int) error {
+		collected = append(collected, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqualsI(t, 2, len(collected))
+
+	// pretend the root was on another device than its files
+	info := mustStat(t, filepath.Join(dir, "library"))
+	if _, _, ok := fileIdentity(info); !ok {
+		t.Skip("devices are not available on this platform")
+	}
+	w.rootDevice++
+	if !w.skipDir(filepath.Join(dir, "library"), info, 1) {
+		t.Error("directories on another device should be skipped")
+	}
+}
+
+func TestGlobPatterns(t *testing.T) {
+	all := []string{"d1/file4.txt", "d1/file5.txt", "exclude-me.txt", "file1.txt", "file2.txt", "file3.txt"}
+	tests := []struct {
+		include, exclude []string
+		expected         []string
+	}{
+		{nil, nil, all},
+		{[]string{"*.txt"}, nil, []string{"exclude-me.txt", "file1.txt", "file2.txt", "file3.txt"}},
+		{[]string{"**/*.txt"}, nil, all},
+		{[]string{"d1/*"}, nil, []string{"d1/file4.txt", "d1/file5.txt"}},
+		{nil, []string{"d1"}, []string{"exclude-me.txt", "file1.txt", "file2.txt", "file3.txt"}},
+		{nil, []string{"**/file{1,4}.txt", "exclude-*"}, []string{"d1/file5.txt", "file2.txt", "file3.txt"}},
+		{[]string{"**/file?.txt"}, []string{"d1/**"}, []string{"file1.txt", "file2.txt", "file3.txt"}},
+	}
+
+	for i, test := range tests {
+		names := collectedNames(t, FileCollectionOptions{
+			DirectoryToSearch: getTestingDir("small"),
+			IncludePatterns:   test.include,
+			ExcludePatterns:   test.exclude,
+		})
+		if !reflect.DeepEqual(test.expected, names) {
+			t.Errorf("test %d: expected %v but got %v", i+1, test.expected, names)
+		}
+	}
+}
+
+func TestGlobPatternsMatchRelativePathsWithSpaces(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMuka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"vendor/lib/testdata/a.txt", "vendor/lib/b.txt", "my docs/c d.txt", "testdata/e.txt"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d, err := CollectFiles(FileCollectionOptions{
+		DirectoryToSearch: dir,
+		ExcludePatterns:   []string{"vendor/**/testdata", "my docs/c d.txt"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range d.EncounteredFiles {
+		names = append(names, filepath.Base(f.AbsolutePath))
+	}
+
+	expected := []string{"e.txt", "b.txt"}
+	if !reflect.DeepEqual(expected, names) {
+		t.Errorf("expected %v but got %v", expected, names)
+	}
+}
+
+func TestInvalidGlobPattern(t *testing.T) {
+	_, err := CollectFiles(FileCollectionOptions{
+		DirectoryToSearch: getTestingDir("small"),
+		IncludePatterns:   []string{"[a-"},
+	})
+	if err == nil {
+		t.Error("expected an invalid pattern to be rejected")
+	}
+}